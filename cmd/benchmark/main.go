@@ -1,7 +1,7 @@
 package main
 
 import (
-	"compgo/comp"
+	"compgo"
 	"compgo/interp"
 	"flag"
 	"log"
@@ -18,37 +18,27 @@ let fibonacci = fn(x) {
 		else { fibonacci(x - 1) + fibonacci(x - 2) }
 	}
 };
-fibonacci(35);
 `
 
 func main() {
 	flag.Parse()
-	var (
-		dur time.Duration
-		res interp.Object
-	)
-	p := interp.NewParser(interp.NewLexer(input))
-	prg := p.ParseProgram()
-	if *engine == "vm" {
-		compiler := comp.New()
-		if err := compiler.Compile(prg); err != nil {
-			log.Printf("compiler error: %s", err)
-			return
-		}
-		mcn := comp.NewVm(compiler.Bytecode())
-		start := time.Now()
-		if err := mcn.Run(); err != nil {
-			log.Printf("vm run error: %s", err)
-			return
-		}
-		dur = time.Since(start)
-		res = mcn.LastPop()
-	} else {
-		env := interp.NewEnvironment()
-		start := time.Now()
-		res = interp.Eval(prg, env)
-		dur = time.Since(start)
+	eng := compgo.VM
+	if *engine != "vm" {
+		eng = compgo.Interpreter
 	}
+	rt := compgo.New(eng)
+	if _, err := rt.Eval(input); err != nil {
+		log.Printf("eval error: %s", err)
+		return
+	}
+	arg, _ := interp.FromGo(35)
+	start := time.Now()
+	res, err := rt.Call("fibonacci", arg)
+	if err != nil {
+		log.Printf("run error: %s", err)
+		return
+	}
+	dur := time.Since(start)
 
 	log.Printf("engine=%s, result=%s, duration=%s\n",
 		*engine, res.Inspect(), dur)
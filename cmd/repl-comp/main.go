@@ -2,8 +2,8 @@ package main
 
 import (
 	"bufio"
-	"compgo/comp"
-	"compgo/interp"
+	"compgo"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -22,58 +22,24 @@ func main() {
 	}
 	fmt.Printf("Welcome %s to REPL!\n\n", user.Username)
 	scanner := bufio.NewScanner(os.Stdin)
-	// env := interp.NewEnvironment()
-	menv := interp.NewEnvironment()
-	cmpiler := comp.New()
-	var mcn *comp.Vm
-	globs := make([]interp.Object, comp.GlobalSize)
-	constants := []interp.Object{}
-	symbolsTable := comp.NewSymbolTable()
-	for i, b := range comp.Builtins {
-		symbolsTable.DefineBuiltin(i, b.Name)
-	}
-	cmpiler.SetSymbolTable(symbolsTable)
-	cmpiler.SetConstants(constants)
+	rt := compgo.New(compgo.VM)
 	for {
 		fmt.Print(Prompt)
 		scn := scanner.Scan()
 		if !scn {
 			return
 		}
-		line := scanner.Text()
-		p := interp.NewParser(interp.NewLexer(line))
-		prg := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(os.Stdout, p.Errors())
-			continue
-		}
-		interp.DefineMacros(prg, menv)
-		mobj := interp.ExpandMacros(prg, menv)
-		cmpiler.Instructions = comp.Instructions{}
-		err := cmpiler.Compile(mobj)
-		if err != nil {
-			fmt.Printf("Compilation failed:\n%s\n", err)
+		res, err := rt.Eval(scanner.Text())
+		var perr *compgo.ParseError
+		if errors.As(err, &perr) {
+			printParserErrors(os.Stdout, perr.Errors)
 			continue
 		}
-		if mcn == nil {
-			mcn = comp.NewVm(cmpiler.Bytecode())
-			mcn.SetGlobals(globs)
-		} else {
-			b := cmpiler.Bytecode()
-			mfn := &comp.CompiledFunction{Instructions: b.Instructions}
-			mcn.SetFrame(comp.NewFrame(&comp.Closure{Fn: mfn}, 0))
-			mcn.Stack = []interp.Object{}
-			mcn.SetConstants(b.Constants)
-			mcn.SetGlobals(globs)
-		}
-		err = mcn.Run()
 		if err != nil {
 			fmt.Printf("Executing bytecode failed:\n%s\n", err)
 			continue
 		}
-
-		stacktop := mcn.LastPop()
-		fmt.Println(stacktop.Inspect())
+		fmt.Println(res.Inspect())
 	}
 }
 
@@ -0,0 +1,83 @@
+package comp
+
+import (
+	"compgo/interp"
+	"errors"
+	"fmt"
+)
+
+// MaxBuiltins is the number of builtins the wide OpGetBuiltin operand can
+// address.
+const MaxBuiltins = 1 << 16
+
+var ErrTooManyBuiltins = fmt.Errorf("too many builtins, the limit is %d", MaxBuiltins)
+
+var errNilBuiltin = errors.New("builtin function is nil")
+
+// standardBuiltins are the interp builtins every registry starts with, in
+// the order of their indexes.
+var standardBuiltins = []string{"len", "first", "last", "rest", "push", "puts", "throw", "compare", "int", "float"}
+
+// Registry is the set of builtins a program can call, indexed by the
+// operand of OpGetBuiltin. The compiler and the VM must share it.
+type Registry struct {
+	names    []string
+	builtins []*interp.Builtin
+	index    map[string]int
+}
+
+// NewRegistry returns a registry holding the standard builtins.
+func NewRegistry() *Registry {
+	r := &Registry{index: map[string]int{}}
+	for _, name := range standardBuiltins {
+		r.Register(name, interp.Builtins[name].Fn)
+	}
+	return r
+}
+
+// Register adds fn under name and returns its index. Registering a name
+// again replaces the function and keeps the index.
+func (r *Registry) Register(name string, fn interp.BuiltinFunction) (int, error) {
+	if fn == nil {
+		return 0, errNilBuiltin
+	}
+	if idx, ok := r.index[name]; ok {
+		r.builtins[idx] = &interp.Builtin{Fn: fn}
+		return idx, nil
+	}
+	if len(r.builtins) >= MaxBuiltins {
+		return 0, ErrTooManyBuiltins
+	}
+	r.index[name] = len(r.builtins)
+	r.names = append(r.names, name)
+	r.builtins = append(r.builtins, &interp.Builtin{Fn: fn})
+	return len(r.builtins) - 1, nil
+}
+
+// Lookup returns the index of the builtin registered under name.
+func (r *Registry) Lookup(name string) (int, bool) {
+	idx, ok := r.index[name]
+	return idx, ok
+}
+
+// Builtin returns the builtin at idx or nil if there is none.
+func (r *Registry) Builtin(idx int) *interp.Builtin {
+	if idx < 0 || idx >= len(r.builtins) {
+		return nil
+	}
+	return r.builtins[idx]
+}
+
+func (r *Registry) Len() int { return len(r.builtins) }
+
+// Names returns the registered names in index order.
+func (r *Registry) Names() []string {
+	return append([]string(nil), r.names...)
+}
+
+// Define defines every registered builtin in st with its index.
+func (r *Registry) Define(st *SymbolTable) {
+	for i, name := range r.names {
+		st.DefineBuiltin(i, name)
+	}
+}
@@ -0,0 +1,82 @@
+package comp
+
+import (
+	"compgo/interp"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func double(args ...interp.Object) interp.Object {
+	i := args[0].(*interp.Integer)
+	return &interp.Integer{Primitive: interp.Primitive[int]{Value: i.Value * 2}}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	for i, name := range standardBuiltins {
+		idx, ok := r.Lookup(name)
+		if !ok || idx != i {
+			t.Errorf("standard builtin %s at wrong index. want=%d got=%d", name, i, idx)
+		}
+	}
+	idx, err := r.Register("double", double)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx != len(standardBuiltins) {
+		t.Errorf("wrong index. want=%d got=%d", len(standardBuiltins), idx)
+	}
+	again, err := r.Register("double", double)
+	if err != nil || again != idx {
+		t.Errorf("registering again changed the index. want=%d got=%d (%v)", idx, again, err)
+	}
+	if r.Builtin(r.Len()) != nil {
+		t.Errorf("builtin out of range is not nil")
+	}
+	for r.Len() < MaxBuiltins {
+		if _, err := r.Register(fmt.Sprintf("b%d", r.Len()), double); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.Register("overflow", double); !errors.Is(err, ErrTooManyBuiltins) {
+		t.Errorf("wrong error. want=%v got=%v", ErrTooManyBuiltins, err)
+	}
+}
+
+func TestRegisterBuiltinVm(t *testing.T) {
+	compiler := New()
+	if err := compiler.RegisterBuiltin("double", double); err != nil {
+		t.Fatal(err)
+	}
+	if err := compiler.Compile(parse(`let f = fn(x) { double(x) }; f(21) + len("a")`)); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	vm := NewVm(compiler.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 43, vm.LastPop())
+
+	// the registration does not leak into other compilers
+	if err := New().Compile(parse(`double(1)`)); err == nil {
+		t.Errorf("double is defined in a new compiler")
+	}
+}
+
+func TestRegisterBuiltin_symbolTable(t *testing.T) {
+	compiler := New()
+	st := NewSymbolTable()
+	compiler.Registry().Define(st)
+	compiler.SetSymbolTable(st)
+	if err := compiler.RegisterBuiltin("double", double); err != nil {
+		t.Fatal(err)
+	}
+	sym, ok := st.ResolveBuiltin("double")
+	if !ok {
+		t.Fatalf("double is not defined in the symbol table")
+	}
+	if idx, _ := compiler.Registry().Lookup("double"); sym.Index != idx {
+		t.Errorf("symbol index differs from registry. want=%d got=%d", idx, sym.Index)
+	}
+}
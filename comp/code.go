@@ -46,6 +46,23 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
+	OpTry
+	OpEndTry
+	OpMod
+	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShl
+	OpShr
+	OpBitNot
+	OpJumpIfTruthy
+	OpSetFree
+	OpBoxLocal
+	OpBoxFree
+	// OpWide prefixes an instruction whose operands are twice their
+	// usual width.
+	OpWide
 )
 
 type Definition struct {
@@ -87,8 +104,25 @@ var definitions = map[Opcode]Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpTry:            {"OpTry", []int{2}},
+	OpEndTry:         {"OpEndTry", []int{}},
+	OpMod:            {"OpMod", []int{}},
+	OpPow:            {"OpPow", []int{}},
+	OpBitAnd:         {"OpBitAnd", []int{}},
+	OpBitOr:          {"OpBitOr", []int{}},
+	OpBitXor:         {"OpBitXor", []int{}},
+	OpShl:            {"OpShl", []int{}},
+	OpShr:            {"OpShr", []int{}},
+	OpBitNot:         {"OpBitNot", []int{}},
+	OpJumpIfTruthy:   {"OpJumpIfTruthy", []int{2}},
+	OpSetFree:        {"OpSetFree", []int{1}},
+	OpBoxLocal:       {"OpBoxLocal", []int{1}},
+	OpBoxFree:        {"OpBoxFree", []int{1}},
+	OpWide:           {"OpWide", []int{}},
 }
 
+// String disassembles i one instruction per line. An OpWide prefix is
+// shown on the line of the instruction it widens.
 func (i Instructions) String() string {
 	var (
 		sb   strings.Builder
@@ -96,6 +130,11 @@ func (i Instructions) String() string {
 	)
 	for addr < len(i) {
 		sb.WriteString(fmt.Sprintf("%04d ", addr))
+		wide := Opcode(i[addr]) == OpWide && addr+1 < len(i)
+		if wide {
+			sb.WriteString("OpWide ")
+			addr++
+		}
 		def, ok := definitions[Opcode(i[addr])]
 		addr++
 		if !ok {
@@ -103,18 +142,15 @@ func (i Instructions) String() string {
 			continue
 		}
 		sb.WriteString(def.Name)
-		for _, lond := range def.OperandWidth {
-			switch lond {
-			case 1:
-				opr := i[addr]
-				addr += lond
-				sb.WriteString(fmt.Sprintf(" %d", opr))
-			case 2:
-				val := binary.BigEndian.Uint16(i[addr : addr+lond])
-				addr += lond
-				sb.WriteString(fmt.Sprintf(" %d", val))
-
+		for _, w := range def.OperandWidth {
+			if wide {
+				w *= 2
+			}
+			if addr+w > len(i) {
+				break
 			}
+			sb.WriteString(fmt.Sprintf(" %d", ReadOperand(i[addr:], w)))
+			addr += w
 		}
 		sb.WriteByte('\n')
 	}
@@ -129,27 +165,73 @@ func Lookup(op byte) (Definition, error) {
 	return def, nil
 }
 
+// Make returns the instruction op with operands, made wide when an operand
+// doesn't fit, or nil when op is unknown or an operand fits no width.
 func Make(op Opcode, operands ...int) []byte {
 	def, ok := definitions[op]
 	if !ok {
 		return nil
 	}
+	for i, o := range operands {
+		if !fits(o, def.OperandWidth[i]) {
+			return MakeWide(op, operands...)
+		}
+	}
+	return makeInstruction(def, op, 1, operands)
+}
+
+// MakeWide returns the instruction op with operands prefixed by OpWide,
+// whatever their values.
+func MakeWide(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok || len(def.OperandWidth) == 0 {
+		return nil
+	}
+	for i, o := range operands {
+		if !fits(o, 2*def.OperandWidth[i]) {
+			return nil
+		}
+	}
+	return append([]byte{byte(OpWide)}, makeInstruction(def, op, 2, operands)...)
+}
+
+func makeInstruction(def Definition, op Opcode, scale int, operands []int) []byte {
 	instlen := 1
 	for _, w := range def.OperandWidth {
-		instlen += w
+		instlen += scale * w
 	}
 	inst := make([]byte, instlen)
 	inst[0] = byte(op)
 	offset := 1
 	for i, o := range operands {
-		width := def.OperandWidth[i]
+		width := scale * def.OperandWidth[i]
 		switch width {
 		case 1:
 			inst[offset] = byte(o)
 		case 2:
 			binary.BigEndian.PutUint16(inst[offset:], uint16(o))
+		case 4:
+			binary.BigEndian.PutUint32(inst[offset:], uint32(o))
 		}
 		offset += width
 	}
 	return inst
 }
+
+// fits reports whether operand can be encoded in width bytes.
+func fits(operand, width int) bool {
+	return operand >= 0 && operand < 1<<(8*width)
+}
+
+// ReadOperand returns the operand of width bytes at the start of ins.
+func ReadOperand(ins Instructions, width int) int {
+	switch width {
+	case 1:
+		return int(ins[0])
+	case 2:
+		return int(binary.BigEndian.Uint16(ins))
+	case 4:
+		return int(binary.BigEndian.Uint32(ins))
+	}
+	return 0
+}
@@ -31,6 +31,12 @@ func TestMake(t *testing.T) {
 		{OpSetLocal, []int{255}, []byte{byte(OpSetLocal), 255}},
 		{OpCall, []int{255}, []byte{byte(OpCall), 255}},
 		{OpClosure, []int{65534, 244}, []byte{byte(OpClosure), 255, 254, 244}},
+		{OpGetLocal, []int{256}, []byte{byte(OpWide), byte(OpGetLocal), 1, 0}},
+		{OpCall, []int{65535}, []byte{byte(OpWide), byte(OpCall), 255, 255}},
+		{OpJump, []int{65536}, []byte{byte(OpWide), byte(OpJump), 0, 1, 0, 0}},
+		{OpClosure, []int{1, 256}, []byte{byte(OpWide), byte(OpClosure), 0, 0, 0, 1, 1, 0}},
+		{OpGetLocal, []int{65536}, nil},
+		{OpJump, []int{-1}, nil},
 	}
 	for _, tt := range tests {
 		inst := Make(tt.op, tt.operands...)
@@ -45,3 +51,14 @@ func TestMake(t *testing.T) {
 		}
 	}
 }
+
+func TestMakeWide(t *testing.T) {
+	inst := MakeWide(OpJump, 12)
+	expected := []byte{byte(OpWide), byte(OpJump), 0, 0, 0, 12}
+	if string(inst) != string(expected) {
+		t.Errorf("wrong instruction. want=%v got=%v", expected, inst)
+	}
+	if inst := MakeWide(OpAdd); inst != nil {
+		t.Errorf("OpAdd made wide. got=%v", inst)
+	}
+}
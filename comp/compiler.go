@@ -3,13 +3,49 @@ package comp
 import (
 	"compgo/interp"
 	"fmt"
+	"strings"
 )
 
 type Compiler struct {
-	Instructions
-	constants                            []interp.Object
+	constants   *ConstantPool
+	symbolTable *SymbolTable
+	file        string
+	currentPos  SourcePos
+	builtins    *Registry
+	options     Options
+	// scopes are the code being compiled, the main program first and the
+	// innermost function literal last.
+	scopes []*CompilationScope
+}
+
+// CompilationScope holds the instructions compiled for the main program
+// or for a function literal.
+type CompilationScope struct {
+	instructions                         Instructions
 	lastInstruction, previousInstruction EmittedInstruction
-	symbolTable                          *SymbolTable
+	sourceMap                            SourceMap
+	// loops are the loops being compiled, innermost last.
+	loops []*loopLabels
+	// tryDepth is how many try bodies are being compiled.
+	tryDepth int
+	// wideJumps makes forward jumps wide, so jumpToHere can patch them
+	// with any address. jumpTooFar is set when a narrow one could not be.
+	wideJumps, jumpTooFar bool
+}
+
+// loopLabels are the jumps of a loop waiting for the address of its end
+// or of its next iteration.
+type loopLabels struct {
+	breaks, continues []int
+	// tryDepth is the compiler tryDepth out of the loop, break and
+	// continue end the try bodies they leave.
+	tryDepth int
+}
+
+// Options select the optimisations of a Compiler, all off by default.
+type Options struct {
+	// Fold compiles programs as folded by Fold, which rewrites them in place.
+	Fold bool
 }
 
 type EmittedInstruction struct {
@@ -18,25 +54,70 @@ type EmittedInstruction struct {
 }
 
 func New() *Compiler {
+	return NewWithRegistry(NewRegistry())
+}
+
+// NewWithRegistry returns a compiler resolving builtins from r. The
+// bytecode it produces carries r for the VM.
+func NewWithRegistry(r *Registry) *Compiler {
 	st := NewSymbolTable()
-	for _, v := range Builtins {
-		st.DefineBuiltin(v.pos, v.Name)
-	}
+	r.Define(st)
 	return &Compiler{
-		Instructions: Instructions{},
-		constants:    []interp.Object{},
-		symbolTable:  st,
+		constants:   NewConstantPool(),
+		symbolTable: st,
+		builtins:    r,
+		scopes:      []*CompilationScope{{instructions: Instructions{}}},
 	}
 }
 
+func (c *Compiler) Registry() *Registry {
+	return c.builtins
+}
+
+// RegisterBuiltin makes fn callable as name by the programs compiled
+// afterwards.
+func (c *Compiler) RegisterBuiltin(name string, fn interp.BuiltinFunction) error {
+	idx, err := c.builtins.Register(name, fn)
+	if err != nil {
+		return err
+	}
+	c.symbolTable.DefineBuiltin(idx, name)
+	return nil
+}
+
 func (c *Compiler) SetConstants(cnts []interp.Object) {
-	c.constants = cnts
+	c.constants = NewConstantPoolFrom(cnts)
+}
+
+// Snapshot returns the function restoring the symbols and constants of c
+// to the current ones, undoing a compilation that failed.
+func (c *Compiler) Snapshot() (restore func()) {
+	restoreSymbols := c.symbolTable.snapshot()
+	mark := c.constants.mark()
+	return func() {
+		restoreSymbols()
+		c.constants.truncate(mark)
+	}
+}
+
+// ConstantPool returns the pool the compiled constants are added to.
+func (c *Compiler) ConstantPool() *ConstantPool {
+	return c.constants
 }
 
 func (c *Compiler) SetSymbolTable(st *SymbolTable) {
 	c.symbolTable = st
 }
 
+func (c *Compiler) SetOptions(opts Options) {
+	c.options = opts
+}
+
+// SetFile sets the file name reported in source positions.
+func (c *Compiler) SetFile(name string) {
+	c.file = name
+}
+
 var mapOpCodes = map[string]Opcode{
 	"+":  OpAdd,
 	"-":  OpSub,
@@ -48,16 +129,39 @@ var mapOpCodes = map[string]Opcode{
 	"<":  OpLt,
 	">=": OpGte,
 	"<=": OpLte,
+	"%":  OpMod,
+	"**": OpPow,
+	"&":  OpBitAnd,
+	"|":  OpBitOr,
+	"^":  OpBitXor,
+	"<<": OpShl,
+	">>": OpShr,
 }
 
+// Compile compiles node into the current scope. A program replaces the
+// main instructions but keeps the constants and symbols, as a REPL needs.
 func (c *Compiler) Compile(node interp.Node) error {
+	if p, ok := node.(positioned); ok && p.Line() > 0 {
+		prev := c.currentPos
+		c.currentPos = SourcePos{Line: p.Line(), Column: p.Column()}
+		defer func() { c.currentPos = prev }()
+	}
 	switch n := node.(type) {
 	case *interp.Program:
-		for _, s := range n.Statements {
-			err := c.Compile(s)
-			if err != nil {
-				return err
+		if c.options.Fold {
+			n = Fold(n).(*interp.Program)
+		}
+		c.scopes = []*CompilationScope{{instructions: Instructions{}}}
+		err := c.compileJumps(func() error {
+			for _, s := range n.Statements {
+				if err := c.Compile(s); err != nil {
+					return err
+				}
 			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 	case *interp.ExpressionStatement:
 		err := c.Compile(n.Expression)
@@ -66,6 +170,12 @@ func (c *Compiler) Compile(node interp.Node) error {
 		}
 		c.emit(OpPop)
 	case *interp.InfixExpression:
+		if n.Operator == "&&" || n.Operator == "||" {
+			if err := c.compileLogicalExpression(n); err != nil {
+				return err
+			}
+			break
+		}
 		err := c.Compile(n.Left)
 		if err != nil {
 			return err
@@ -83,26 +193,39 @@ func (c *Compiler) Compile(node interp.Node) error {
 	case *interp.PrefixExpression:
 		err := c.Compile(n.Right)
 		if err != nil {
-			return nil
+			return err
 		}
 		switch n.Operator {
 		case "-":
 			c.emit(OpMinus)
 		case "!":
 			c.emit(OpBang)
+		case "~":
+			c.emit(OpBitNot)
 		default:
 			return fmt.Errorf("unknown operator %s", n.Operator)
 		}
 	case *interp.IntLiteral:
 		itg := &interp.Integer{Primitive: interp.Primitive[int]{Value: n.Value}}
-		c.constants = append(c.constants, itg)
-		c.emit(OpConstant, len(c.constants)-1)
+		if _, err := c.emit(OpConstant, c.constants.Add(itg)); err != nil {
+			return err
+		}
+	case *interp.BigIntLiteral:
+		if _, err := c.emit(OpConstant, c.constants.Add(interp.NewBigInteger(n.Value))); err != nil {
+			return err
+		}
+	case *interp.FloatLiteral:
+		flt := &interp.Float{Primitive: interp.Primitive[float64]{Value: n.Value}}
+		if _, err := c.emit(OpConstant, c.constants.Add(flt)); err != nil {
+			return err
+		}
 	case *interp.StringLiteral:
 		str := &interp.String{Primitive: interp.Primitive[string]{
 			Value: n.Value,
 		}}
-		c.constants = append(c.constants, str)
-		c.emit(OpConstant, len(c.constants)-1)
+		if _, err := c.emit(OpConstant, c.constants.Add(str)); err != nil {
+			return err
+		}
 	case *interp.BooleanLiteral:
 		if n.Value {
 			c.emit(OpTrue)
@@ -119,39 +242,70 @@ func (c *Compiler) Compile(node interp.Node) error {
 		if err := c.compileIfExpression(n); err != nil {
 			return err
 		}
+	case *interp.WhileExpression:
+		if err := c.compileLoop(nil, n.Condition, nil, n.Body); err != nil {
+			return err
+		}
+	case *interp.ForExpression:
+		if err := c.compileLoop(n.Init, n.Condition, n.Post, n.Body); err != nil {
+			return err
+		}
+	case *interp.BreakStatement:
+		if err := c.compileLoopControl(true); err != nil {
+			return err
+		}
+	case *interp.ContinueStatement:
+		if err := c.compileLoopControl(false); err != nil {
+			return err
+		}
 	case *interp.LetStatement:
-		sym := c.symbolTable.Define(n.Name.Value)
+		sym, err := c.define(n.Name.Value)
+		if err != nil {
+			return err
+		}
 		if err := c.Compile(n.Value); err != nil {
 			return err
 		}
+		op := OpSetLocal
 		if sym.Scope == GlobalScope {
-			c.emit(OpSetGlobal, sym.Index)
-		} else {
-			c.emit(OpSetLocal, sym.Index)
+			op = OpSetGlobal
+		}
+		if _, err := c.emit(op, sym.Index); err != nil {
+			return err
+		}
+	case *interp.AssignExpression:
+		if err := c.compileAssignExpression(n); err != nil {
+			return err
 		}
 	case *interp.Identifier:
 		sym, ok := c.symbolTable.Resolve(n.Value)
 		if !ok {
 			return fmt.Errorf("ident %s is not resolvable", n.Value)
 		}
-		c.emitSymbol(sym)
+		if err := c.emitSymbol(sym); err != nil {
+			return err
+		}
 	case *interp.Slices:
 		for _, e := range n.Elements {
 			if err := c.Compile(e); err != nil {
 				return err
 			}
 		}
-		c.emit(OpArray, len(n.Elements))
+		if _, err := c.emit(OpArray, len(n.Elements)); err != nil {
+			return err
+		}
 	case *interp.HashLiteral:
-		for k, v := range n.Pairs {
+		for _, k := range n.SortedKeys() {
 			if err := c.Compile(k); err != nil {
 				return err
 			}
-			if err := c.Compile(v); err != nil {
+			if err := c.Compile(n.Pairs[k]); err != nil {
 				return err
 			}
 		}
-		c.emit(OpHash, len(n.Pairs)*2)
+		if _, err := c.emit(OpHash, len(n.Pairs)*2); err != nil {
+			return err
+		}
 	case *interp.CallIndex:
 		if err := c.Compile(n.Left); err != nil {
 			return err
@@ -161,48 +315,22 @@ func (c *Compiler) Compile(node interp.Node) error {
 		}
 		c.emit(OpIndex)
 	case *interp.FuncLiteral:
-		defbegin := len(c.Instructions)
-		c.SetSymbolTable(NewFrameSymbolTable(c.symbolTable))
-		if n.Name != "" {
-			c.symbolTable.DefineFunctionName(n.Name)
-		}
-		for _, p := range n.Parameters {
-			c.symbolTable.Define(p.Value)
+		if err := c.compileFuncLiteral(n); err != nil {
+			return err
 		}
-		defbody := len(c.Instructions)
-		if err := c.Compile(n.Body); err != nil {
+	case *interp.TryExpression:
+		if err := c.compileTryExpression(n); err != nil {
 			return err
 		}
-		defend := len(c.Instructions)
-		cmpf := &CompiledFunction{make(Instructions, 0),
-			c.symbolTable.numdef, len(n.Parameters)}
-		if c.lastInstruction.Opcode == OpPop {
-			retins := Make(OpReturnValue)
-			for i, ch := range retins {
-				c.Instructions[c.lastInstruction.Pos+i] = ch
-			}
-		} else if defend-defbegin == 0 || defend-defbody == 0 {
-			c.emit(OpReturn)
-			defend = len(c.Instructions)
-		}
-		freesyms := c.symbolTable.FreeSymbols
-		for _, s := range freesyms {
-			c.emitSymbol(s)
-		}
-		defcurrent := len(c.Instructions)
-		c.SetSymbolTable(c.symbolTable.scoped)
-		cmpf.Instructions = append(cmpf.Instructions, c.Instructions[defbegin:defend]...)
-		c.constants = append(c.constants, cmpf)
-		currInst := c.Instructions
-		c.Instructions = c.Instructions[:defbegin]
-		c.Instructions = append(c.Instructions, currInst[defend:defcurrent]...)
-		c.emit(OpClosure, len(c.constants)-1, len(freesyms))
 	case *interp.ReturnStatement:
 		if err := c.Compile(n.Value); err != nil {
 			return err
 		}
 		c.emit(OpReturnValue)
 	case *interp.CallExpression:
+		if len(n.Args) > MaxArgs {
+			return fmt.Errorf("too many arguments: %d, the limit is %d", len(n.Args), MaxArgs)
+		}
 		if err := c.Compile(n.Func); err != nil {
 			return err
 		}
@@ -211,82 +339,438 @@ func (c *Compiler) Compile(node interp.Node) error {
 				return err
 			}
 		}
-		c.emit(OpCall, len(n.Args))
+		if _, err := c.emit(OpCall, len(n.Args)); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+func (c *Compiler) scope() *CompilationScope {
+	return c.scopes[len(c.scopes)-1]
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, &CompilationScope{instructions: Instructions{}})
+	c.symbolTable = NewFrameSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() *CompilationScope {
+	scope := c.scope()
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.symbolTable = c.symbolTable.scoped
+	return scope
+}
+
+// compileFuncLiteral compiles n in its own scope to a CompiledFunction
+// constant and emits the closure over its free variables.
+func (c *Compiler) compileFuncLiteral(n *interp.FuncLiteral) error {
+	c.enterScope()
+	if n.Name != "" {
+		c.symbolTable.DefineFunctionName(n.Name)
+	}
+	for _, p := range n.Parameters {
+		if _, err := c.define(p.Value); err != nil {
+			c.leaveScope()
+			return err
+		}
+	}
+	err := c.compileJumps(func() error {
+		if err := c.Compile(n.Body); err != nil {
+			return err
+		}
+		if c.scope().lastInstruction.Opcode == OpPop {
+			last := c.scope().lastInstruction.Pos
+			copy(c.scope().instructions[last:], Make(OpReturnValue))
+			c.scope().lastInstruction.Opcode = OpReturnValue
+		}
+		if c.scope().lastInstruction.Opcode != OpReturnValue {
+			c.emit(OpReturn)
+		}
+		return nil
+	})
+	freesyms := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numdef
+	scope := c.leaveScope()
+	if err != nil {
+		return err
+	}
+	if len(freesyms) > MaxFree {
+		return fmt.Errorf("too many free variables: %d, the limit is %d", len(freesyms), MaxFree)
+	}
+	for _, s := range freesyms {
+		if err := c.emitCapture(s); err != nil {
+			return err
+		}
+	}
+	idx := c.constants.Add(&CompiledFunction{
+		Instructions: scope.instructions,
+		NumLocals:    numLocals,
+		NumArgs:      len(n.Parameters),
+		Name:         n.Name,
+		File:         c.file,
+		SourceMap:    scope.sourceMap,
+	})
+	_, err = c.emit(OpClosure, idx, len(freesyms))
+	return err
+}
+
+// compileJumps runs compile into the empty current scope, and again with
+// wide jumps, from the same constants and symbols, when a jump is too far.
+func (c *Compiler) compileJumps(compile func() error) error {
+	restore := c.Snapshot()
+	for _, wide := range []bool{false, true} {
+		scope := c.scope()
+		*scope = CompilationScope{instructions: Instructions{}, wideJumps: wide}
+		restore()
+		if err := compile(); err != nil {
+			return err
+		}
+		if !scope.jumpTooFar {
+			return nil
+		}
+	}
+	return fmt.Errorf("too many instructions: %d", len(c.scope().instructions))
+}
+
+// define defines name in the current symbol table, failing when its slot
+// cannot be addressed.
+func (c *Compiler) define(name string) (Symbol, error) {
+	sym := c.symbolTable.Define(name)
+	if sym.Scope == GlobalScope && sym.Index >= GlobalSize {
+		return sym, fmt.Errorf("too many globals: %d, the limit is %d", sym.Index+1, GlobalSize)
+	}
+	if sym.Scope == LocalScope && sym.Index >= MaxLocals {
+		return sym, fmt.Errorf("too many locals: %d, the limit is %d", sym.Index+1, MaxLocals)
+	}
+	return sym, nil
+}
+
 func (c *Compiler) removeLastIfPop() {
-	if c.lastInstruction.Opcode == OpPop {
-		c.Instructions = c.Instructions[:c.lastInstruction.Pos]
-		c.lastInstruction = c.previousInstruction
+	scope := c.scope()
+	if scope.lastInstruction.Opcode == OpPop {
+		scope.instructions = scope.instructions[:scope.lastInstruction.Pos]
+		scope.lastInstruction = scope.previousInstruction
 	}
 }
 
+// jumpToHere patches the jump op emitted by emitJump at from to jump to
+// the next instruction.
 func (c *Compiler) jumpToHere(op Opcode, from int) {
-	target := Make(op, len(c.Instructions))
-	for i, t := range target {
-		c.Instructions[from+i] = t
+	scope := c.scope()
+	addr := len(scope.instructions)
+	var ins []byte
+	if Opcode(scope.instructions[from]) == OpWide {
+		ins = MakeWide(op, addr)
+	} else if fits(addr, definitions[op].OperandWidth[0]) {
+		ins = Make(op, addr)
 	}
-
+	if ins == nil {
+		scope.jumpTooFar = true
+		return
+	}
+	copy(scope.instructions[from:], ins)
 }
+
 func (c *Compiler) compileIfExpression(n *interp.IfExpression) error {
 	err := c.Compile(n.Condition)
 	if err != nil {
 		return err
 	}
-	jumpyPost := c.emit(OpJumpIfFalsy, 0)
+	jumpyPost := c.emitJump(OpJumpIfFalsy)
 	err = c.Compile(n.Then)
 	if err != nil {
 		return err
 	}
-	c.removeLastIfPop()
-	jumpAnyway := c.emit(OpJump, 0)
+	c.blockValue()
+	jumpAnyway := c.emitJump(OpJump)
 	c.jumpToHere(OpJumpIfFalsy, jumpyPost)
 	if n.Else != nil {
 		if err = c.Compile(n.Else); err != nil {
 			return err
 		}
+		c.blockValue()
 	} else {
 		c.emit(OpNull)
 	}
-	c.removeLastIfPop()
+	c.jumpToHere(OpJump, jumpAnyway)
+	return nil
+}
+
+// compileLoop compiles a while or for loop, leaving null as its value.
+// init, cond and post may be nil.
+func (c *Compiler) compileLoop(init interp.Statement, cond interp.Expression,
+	post interp.Statement, body *interp.BlockStatement) error {
+	if init != nil {
+		if err := c.Compile(init); err != nil {
+			return err
+		}
+	}
+	start := len(c.scope().instructions)
+	exit := -1
+	if cond != nil {
+		if err := c.Compile(cond); err != nil {
+			return err
+		}
+		exit = c.emitJump(OpJumpIfFalsy)
+	}
+	scope := c.scope()
+	loop := &loopLabels{tryDepth: scope.tryDepth}
+	scope.loops = append(scope.loops, loop)
+	err := c.Compile(body)
+	scope.loops = scope.loops[:len(scope.loops)-1]
+	if err != nil {
+		return err
+	}
+	for _, pos := range loop.continues {
+		c.jumpToHere(OpJump, pos)
+	}
+	if post != nil {
+		if err := c.Compile(post); err != nil {
+			return err
+		}
+	}
+	if _, err := c.emit(OpJump, start); err != nil {
+		return err
+	}
+	if exit >= 0 {
+		c.jumpToHere(OpJumpIfFalsy, exit)
+	}
+	for _, pos := range loop.breaks {
+		c.jumpToHere(OpJump, pos)
+	}
+	c.emit(OpNull)
+	return nil
+}
+
+// compileLoopControl compiles break, or continue when brk is false, to a
+// jump patched once the innermost loop is compiled.
+func (c *Compiler) compileLoopControl(brk bool) error {
+	scope := c.scope()
+	if len(scope.loops) == 0 {
+		if brk {
+			return fmt.Errorf("break outside of a loop")
+		}
+		return fmt.Errorf("continue outside of a loop")
+	}
+	loop := scope.loops[len(scope.loops)-1]
+	for range scope.tryDepth - loop.tryDepth {
+		c.emit(OpEndTry)
+	}
+	pos := c.emitJump(OpJump)
+	if brk {
+		loop.breaks = append(loop.breaks, pos)
+	} else {
+		loop.continues = append(loop.continues, pos)
+	}
+	return nil
+}
+
+// compileAssignExpression stores the value of n in the variable it names,
+// which must be defined, and leaves the value on the stack.
+func (c *Compiler) compileAssignExpression(n *interp.AssignExpression) error {
+	sym, ok := c.symbolTable.Resolve(n.Name.Value)
+	if !ok {
+		return fmt.Errorf("assignment to undefined ident %s", n.Name.Value)
+	}
+	if sym.Scope == BuiltinScope || sym.Scope == FunctionScope {
+		return fmt.Errorf("cannot assign to %s", n.Name.Value)
+	}
+	op := strings.TrimSuffix(n.Operator, "=")
+	if op != "" {
+		if err := c.emitSymbol(sym); err != nil {
+			return err
+		}
+	}
+	if err := c.Compile(n.Value); err != nil {
+		return err
+	}
+	if op != "" {
+		nop, ok := mapOpCodes[op]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", n.Operator)
+		}
+		c.emit(nop)
+	}
+	set := OpSetLocal
+	switch sym.Scope {
+	case GlobalScope:
+		set = OpSetGlobal
+	case FreeScope:
+		set = OpSetFree
+	}
+	if _, err := c.emit(set, sym.Index); err != nil {
+		return err
+	}
+	return c.emitSymbol(sym)
+}
+
+// compileLogicalExpression compiles && and || to a boolean, skipping the
+// right operand once the left one decides the result.
+func (c *Compiler) compileLogicalExpression(n *interp.InfixExpression) error {
+	jump, decided, undecided := OpJumpIfFalsy, OpFalse, OpTrue
+	if n.Operator == "||" {
+		jump, decided, undecided = OpJumpIfTruthy, OpTrue, OpFalse
+	}
+	if err := c.Compile(n.Left); err != nil {
+		return err
+	}
+	jumpLeft := c.emitJump(jump)
+	if err := c.Compile(n.Right); err != nil {
+		return err
+	}
+	jumpRight := c.emitJump(jump)
+	c.emit(undecided)
+	jumpEnd := c.emitJump(OpJump)
+	c.jumpToHere(jump, jumpLeft)
+	c.jumpToHere(jump, jumpRight)
+	c.emit(decided)
+	c.jumpToHere(OpJump, jumpEnd)
+	return nil
+}
+
+// blockValue leaves the value of the block just compiled on the stack,
+// which is null when the block doesn't end with an expression.
+func (c *Compiler) blockValue() {
+	if c.scope().lastInstruction.Opcode == OpPop {
+		c.removeLastIfPop()
+		return
+	}
+	c.emit(OpNull)
+}
+
+func (c *Compiler) compileTryExpression(n *interp.TryExpression) error {
+	tryPos := c.emitJump(OpTry)
+	c.scope().tryDepth++
+	err := c.Compile(n.Body)
+	c.scope().tryDepth--
+	if err != nil {
+		return err
+	}
+	c.blockValue()
+	c.emit(OpEndTry)
+	jumpAnyway := c.emitJump(OpJump)
+	c.jumpToHere(OpTry, tryPos)
+	// the catch block has its own scope, like in the interpreter
+	leave := c.symbolTable.EnterBlock()
+	defer leave()
+	sym, err := c.define(n.Param.Value)
+	if err != nil {
+		return err
+	}
+	op := OpSetLocal
+	if sym.Scope == GlobalScope {
+		op = OpSetGlobal
+	}
+	if _, err := c.emit(op, sym.Index); err != nil {
+		return err
+	}
+	if err := c.Compile(n.Catch); err != nil {
+		return err
+	}
+	c.blockValue()
 	c.jumpToHere(OpJump, jumpAnyway)
 	return nil
 }
 
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
-		Instructions: c.Instructions,
-		Constants:    c.constants,
+		Instructions: c.scopes[0].instructions,
+		Constants:    c.constants.Objects(),
+		File:         c.file,
+		SourceMap:    c.scopes[0].sourceMap,
+		Builtins:     c.builtins,
 	}
 }
 
-func (c *Compiler) emit(op Opcode, operands ...int) int {
+// emit emits op with operands, failing when an operand fits no width.
+func (c *Compiler) emit(op Opcode, operands ...int) (int, error) {
 	ins := Make(op, operands...)
-	pos := len(c.Instructions)
-	c.Instructions = append(c.Instructions, ins...)
-	c.previousInstruction = c.lastInstruction
-	c.lastInstruction = EmittedInstruction{op, pos}
+	if ins == nil {
+		return 0, fmt.Errorf("cannot encode %s with operands %v", definitions[op].Name, operands)
+	}
+	return c.emitInstruction(op, ins), nil
+}
+
+func (c *Compiler) emitInstruction(op Opcode, ins []byte) int {
+	scope := c.scope()
+	pos := len(scope.instructions)
+	scope.instructions = append(scope.instructions, ins...)
+	scope.previousInstruction = scope.lastInstruction
+	scope.lastInstruction = EmittedInstruction{op, pos}
+	c.markPosition(pos)
+	return pos
+}
+
+// emitJump emits the jump op to be patched by jumpToHere, wide when the
+// scope needs it.
+func (c *Compiler) emitJump(op Opcode) int {
+	if c.scope().wideJumps {
+		return c.emitInstruction(op, MakeWide(op, 0))
+	}
+	pos, _ := c.emit(op, 0)
 	return pos
 }
 
-func (c *Compiler) emitSymbol(sym Symbol) {
+func (c *Compiler) markPosition(offset int) {
+	scope := c.scope()
+	// entries at or after offset belong to instructions that have been
+	// removed or reset, e.g. by removeLastIfPop.
+	for len(scope.sourceMap) > 0 && scope.sourceMap[len(scope.sourceMap)-1].Offset >= offset {
+		scope.sourceMap = scope.sourceMap[:len(scope.sourceMap)-1]
+	}
+	if c.currentPos.Line == 0 {
+		return
+	}
+	if len(scope.sourceMap) > 0 {
+		last := scope.sourceMap[len(scope.sourceMap)-1]
+		if last.Line == c.currentPos.Line && last.Column == c.currentPos.Column {
+			return
+		}
+	}
+	sp := c.currentPos
+	sp.Offset = offset
+	scope.sourceMap = append(scope.sourceMap, sp)
+}
+
+func (c *Compiler) emitSymbol(sym Symbol) error {
+	var err error
 	switch sym.Scope {
 	case GlobalScope:
-		c.emit(OpGetGlobal, sym.Index)
+		_, err = c.emit(OpGetGlobal, sym.Index)
 	case LocalScope:
-		c.emit(OpGetLocal, sym.Index)
+		_, err = c.emit(OpGetLocal, sym.Index)
 	case BuiltinScope:
-		c.emit(OpGetBuiltin, sym.Index)
+		_, err = c.emit(OpGetBuiltin, sym.Index)
 	case FreeScope:
-		c.emit(OpGetFree, sym.Index)
+		_, err = c.emit(OpGetFree, sym.Index)
 	case FunctionScope:
 		c.emit(OpCurrentClosure)
 	}
+	return err
+}
+
+// emitCapture pushes sym for OpClosure. Local and free variables are
+// pushed boxed, so the closure shares them with the enclosing function.
+func (c *Compiler) emitCapture(sym Symbol) error {
+	var err error
+	switch sym.Scope {
+	case LocalScope:
+		_, err = c.emit(OpBoxLocal, sym.Index)
+	case FreeScope:
+		_, err = c.emit(OpBoxFree, sym.Index)
+	default:
+		err = c.emitSymbol(sym)
+	}
+	return err
 }
 
 type Bytecode struct {
 	Instructions
 	Constants []interp.Object
+	File      string
+	SourceMap SourceMap
+	// Builtins is the registry the bytecode was compiled against. It is
+	// not encoded, see Vm.SetBuiltins.
+	Builtins *Registry
 }
@@ -50,6 +50,43 @@ func TestIntegerArithCompile(t *testing.T) {
 			Make(OpMinus),
 			Make(OpPop),
 		}},
+		{"1 % 2 ** 3", []any{1, 2, 3}, []Instructions{
+			Make(OpConstant, 0),
+			Make(OpConstant, 1),
+			Make(OpConstant, 2),
+			Make(OpPow),
+			Make(OpMod),
+			Make(OpPop),
+		}},
+		{"1 & 2 | 3 ^ 4", []any{1, 2, 3, 4}, []Instructions{
+			Make(OpConstant, 0),
+			Make(OpConstant, 1),
+			Make(OpBitAnd),
+			Make(OpConstant, 2),
+			Make(OpBitOr),
+			Make(OpConstant, 3),
+			Make(OpBitXor),
+			Make(OpPop),
+		}},
+		{"1 << 2 >> 3", []any{1, 2, 3}, []Instructions{
+			Make(OpConstant, 0),
+			Make(OpConstant, 1),
+			Make(OpShl),
+			Make(OpConstant, 2),
+			Make(OpShr),
+			Make(OpPop),
+		}},
+		{"~1", []any{1}, []Instructions{
+			Make(OpConstant, 0),
+			Make(OpBitNot),
+			Make(OpPop),
+		}},
+		{"1.5 * 2", []any{1.5, 2}, []Instructions{
+			Make(OpConstant, 0),
+			Make(OpConstant, 1),
+			Make(OpMul),
+			Make(OpPop),
+		}},
 	}
 	runCompilerTest(t, tests)
 }
@@ -173,6 +210,11 @@ func testConstants(t *testing.T, expected []any, actual []interp.Object) error {
 			if err != nil {
 				return fmt.Errorf("constant %d - testIntegerObject failed: %s", i, err)
 			}
+		case float64:
+			err := testFloatObject(constant, actual[i])
+			if err != nil {
+				return fmt.Errorf("constant %d - testFloatObject failed: %s", i, err)
+			}
 		case []Instructions:
 			fn, ok := actual[i].(*CompiledFunction)
 			if !ok {
@@ -199,6 +241,17 @@ func testIntegerObject(n int, o interp.Object) error {
 	return nil
 }
 
+func testFloatObject(f float64, o interp.Object) error {
+	fl, ok := o.(*interp.Float)
+	if !ok {
+		return fmt.Errorf("object is not float. got=%T (%+v)", o, o)
+	}
+	if fl.Value != f {
+		return fmt.Errorf("object wrong value. got=%g want=%g", fl.Value, f)
+	}
+	return nil
+}
+
 func TestInstructionsString(t *testing.T) {
 	inst := []Instructions{
 		Make(OpAdd),
@@ -210,6 +263,8 @@ func TestInstructionsString(t *testing.T) {
 		Make(OpGetLocal, 3),
 		Make(OpCall, 3),
 		Make(OpClosure, 4, 4),
+		Make(OpGetLocal, 300),
+		Make(OpClosure, 70000, 2),
 	}
 	t.Log("1:", Make(OpConstant, 1))
 	t.Log("2:", Make(OpConstant, 2))
@@ -224,6 +279,8 @@ func TestInstructionsString(t *testing.T) {
 0013 OpGetLocal 3
 0015 OpCall 3
 0017 OpClosure 4 4
+0021 OpWide OpGetLocal 300
+0025 OpWide OpClosure 70000 2
 `)
 	insts := Instructions{}
 	for _, ins := range inst {
@@ -267,6 +324,78 @@ func TestConditionalsCompile(t *testing.T) {
 	}
 	runCompilerTest(t, tests)
 }
+
+func TestLogicalCompile(t *testing.T) {
+	tests := []compilerTestCase{
+		{`true && false`, []any{}, []Instructions{
+			Make(OpTrue),            // 0000
+			Make(OpJumpIfFalsy, 12), // 0001
+			Make(OpFalse),           // 0004
+			Make(OpJumpIfFalsy, 12), // 0005
+			Make(OpTrue),            // 0008
+			Make(OpJump, 13),        // 0009
+			Make(OpFalse),           // 0012
+			Make(OpPop),             // 0013
+		}},
+		{`1 || 2`, []any{1, 2}, []Instructions{
+			Make(OpConstant, 0),      // 0000
+			Make(OpJumpIfTruthy, 16), // 0003
+			Make(OpConstant, 1),      // 0006
+			Make(OpJumpIfTruthy, 16), // 0009
+			Make(OpFalse),            // 0012
+			Make(OpJump, 17),         // 0013
+			Make(OpTrue),             // 0016
+			Make(OpPop),              // 0017
+		}},
+	}
+	runCompilerTest(t, tests)
+}
+
+func TestTryCompile(t *testing.T) {
+	tests := []compilerTestCase{
+		{`try { 1 } catch (e) { e }`, []any{1}, []Instructions{
+			Make(OpTry, 10),      // 0000
+			Make(OpConstant, 0),  // 0003
+			Make(OpEndTry),       // 0006
+			Make(OpJump, 16),     // 0007
+			Make(OpSetGlobal, 0), // 0010
+			Make(OpGetGlobal, 0), // 0013
+			Make(OpPop),          // 0016
+		}},
+	}
+	runCompilerTest(t, tests)
+}
+
+func TestLoopCompile(t *testing.T) {
+	tests := []compilerTestCase{
+		{`while (true) { break }`, []any{}, []Instructions{
+			Make(OpTrue),            // 0000
+			Make(OpJumpIfFalsy, 10), // 0001
+			Make(OpJump, 10),        // 0004
+			Make(OpJump, 0),         // 0007
+			Make(OpNull),            // 0010
+			Make(OpPop),             // 0011
+		}},
+		{`for (let i = 0; i < 2; let i = i + 1) { continue }`, []any{0, 2, 1}, []Instructions{
+			Make(OpConstant, 0),     // 0000
+			Make(OpSetGlobal, 0),    // 0003
+			Make(OpGetGlobal, 0),    // 0006
+			Make(OpConstant, 1),     // 0009
+			Make(OpLt),              // 0012
+			Make(OpJumpIfFalsy, 32), // 0013
+			Make(OpJump, 19),        // 0016
+			Make(OpGetGlobal, 0),    // 0019
+			Make(OpConstant, 2),     // 0022
+			Make(OpAdd),             // 0025
+			Make(OpSetGlobal, 0),    // 0026
+			Make(OpJump, 6),         // 0029
+			Make(OpNull),            // 0032
+			Make(OpPop),             // 0033
+		}},
+	}
+	runCompilerTest(t, tests)
+}
+
 func TestGlobalLetStatements(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -440,14 +569,14 @@ func TestIndexExpressionCompile(t *testing.T) {
 	tests := []compilerTestCase{
 		{
 			input:             `[1, 2, 3][1+1]`,
-			expectedConstants: []any{1, 2, 3, 1, 1},
+			expectedConstants: []any{1, 2, 3},
 			expectedInstructions: []Instructions{
 				Make(OpConstant, 0),
 				Make(OpConstant, 1),
 				Make(OpConstant, 2),
 				Make(OpArray, 3),
-				Make(OpConstant, 3),
-				Make(OpConstant, 4),
+				Make(OpConstant, 0),
+				Make(OpConstant, 0),
 				Make(OpAdd),
 				Make(OpIndex),
 				Make(OpPop),
@@ -455,13 +584,13 @@ func TestIndexExpressionCompile(t *testing.T) {
 		},
 		{
 			input:             `{1: 2}[2-1]`,
-			expectedConstants: []any{1, 2, 2, 1},
+			expectedConstants: []any{1, 2},
 			expectedInstructions: []Instructions{
 				Make(OpConstant, 0),
 				Make(OpConstant, 1),
 				Make(OpHash, 2),
-				Make(OpConstant, 2),
-				Make(OpConstant, 3),
+				Make(OpConstant, 1),
+				Make(OpConstant, 0),
 				Make(OpSub),
 				Make(OpIndex),
 				Make(OpPop),
@@ -682,6 +811,161 @@ func TestLetStatement_scopesCompile(t *testing.T) {
 	runCompilerTest(t, tests)
 }
 
+func TestCompilerScopes(t *testing.T) {
+	compiler := New()
+	global := compiler.symbolTable
+	compiler.emit(OpMul)
+
+	compiler.enterScope()
+	if len(compiler.scopes) != 2 {
+		t.Fatalf("wrong scope count. got=%d want=2", len(compiler.scopes))
+	}
+	compiler.emit(OpSub)
+	if got := len(compiler.scope().instructions); got != 1 {
+		t.Errorf("wrong instruction length in inner scope. got=%d want=1", got)
+	}
+	if last := compiler.scope().lastInstruction.Opcode; last != OpSub {
+		t.Errorf("wrong last instruction. got=%d want=%d", last, OpSub)
+	}
+	if compiler.symbolTable.scoped != global {
+		t.Errorf("inner symbol table does not enclose the global one")
+	}
+
+	scope := compiler.leaveScope()
+	if scope.instructions.String() != Instructions(Make(OpSub)).String() {
+		t.Errorf("wrong instructions left in inner scope. got=%q", scope.instructions)
+	}
+	if compiler.symbolTable != global {
+		t.Errorf("global symbol table not restored")
+	}
+	compiler.emit(OpAdd)
+	main := compiler.scope()
+	if len(main.instructions) != 2 {
+		t.Errorf("wrong instruction length in main scope. got=%d want=2", len(main.instructions))
+	}
+	if main.lastInstruction.Opcode != OpAdd || main.previousInstruction.Opcode != OpMul {
+		t.Errorf("wrong last instructions. got=%d, %d want=%d, %d",
+			main.lastInstruction.Opcode, main.previousInstruction.Opcode, OpAdd, OpMul)
+	}
+}
+
+func TestFunctions_jumpsCompile(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `let a = 1; fn(x) { if (x) { a } else { 2 } }`,
+			expectedConstants: []any{1, 2,
+				[]Instructions{
+					Make(OpGetLocal, 0),     // 0000
+					Make(OpJumpIfFalsy, 11), // 0002
+					Make(OpGetGlobal, 0),    // 0005
+					Make(OpJump, 14),        // 0008
+					Make(OpConstant, 1),     // 0011
+					Make(OpReturnValue),     // 0014
+				},
+			},
+			expectedInstructions: []Instructions{
+				Make(OpConstant, 0),
+				Make(OpSetGlobal, 0),
+				Make(OpClosure, 2, 0),
+				Make(OpPop),
+			},
+		},
+		{
+			input: `fn() { let a = 1 }`,
+			expectedConstants: []any{1,
+				[]Instructions{
+					Make(OpConstant, 0),
+					Make(OpSetLocal, 0),
+					Make(OpReturn),
+				},
+			},
+			expectedInstructions: []Instructions{
+				Make(OpClosure, 1, 0),
+				Make(OpPop),
+			},
+		},
+	}
+	runCompilerTest(t, tests)
+}
+
+func TestConstantsCompile_dedupe(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let s = "a"; for (let i = 0; i < 1; i += 1) { s += "a" + 1 }; 1.0`,
+			expectedConstants: []any{"a", 0, 1, 1.0},
+			expectedInstructions: []Instructions{
+				Make(OpConstant, 0),
+				Make(OpSetGlobal, 0),
+				Make(OpConstant, 1),
+				Make(OpSetGlobal, 1),
+				Make(OpGetGlobal, 1),
+				Make(OpConstant, 2),
+				Make(OpLt),
+				Make(OpJumpIfFalsy, 57),
+				Make(OpGetGlobal, 0),
+				Make(OpConstant, 0),
+				Make(OpConstant, 2),
+				Make(OpAdd),
+				Make(OpAdd),
+				Make(OpSetGlobal, 0),
+				Make(OpGetGlobal, 0),
+				Make(OpPop),
+				Make(OpGetGlobal, 1),
+				Make(OpConstant, 2),
+				Make(OpAdd),
+				Make(OpSetGlobal, 1),
+				Make(OpGetGlobal, 1),
+				Make(OpPop),
+				Make(OpJump, 12),
+				Make(OpNull),
+				Make(OpPop),
+				Make(OpConstant, 3),
+				Make(OpPop),
+			},
+		},
+	}
+	runCompilerTest(t, tests)
+
+	compiler := New()
+	for range 3 {
+		if err := compiler.Compile(parse(`len("abc") + 1`)); err != nil {
+			t.Fatalf("compile error: %s", err)
+		}
+	}
+	expected := PoolStats{Size: 2, Added: 2, Reused: 4}
+	if stats := compiler.ConstantPool().Stats(); stats != expected {
+		t.Errorf("wrong pool stats. want=%+v got=%+v", expected, stats)
+	}
+}
+
+func TestCompiler_reusable(t *testing.T) {
+	compiler := New()
+	if err := compiler.Compile(parse("let a = 1;")); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	if err := compiler.Compile(parse("fn() { while (true) { b } }")); err == nil {
+		t.Fatalf("expected a compile error")
+	}
+	if err := compiler.Compile(parse("let c = a + 2; c")); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	bc := compiler.Bytecode()
+	err := testInstructions(t, []Instructions{
+		Make(OpGetGlobal, 0),
+		Make(OpConstant, 1),
+		Make(OpAdd),
+		Make(OpSetGlobal, 1),
+		Make(OpGetGlobal, 1),
+		Make(OpPop),
+	}, bc.Instructions)
+	if err != nil {
+		t.Fatalf("test instruction failed: %s", err)
+	}
+	if err := testConstants(t, []any{1, 2}, bc.Constants); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestBuiltinsCompile(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -717,7 +1001,7 @@ func TestClosure_1Compile(t *testing.T) {
 					Make(OpReturnValue),
 				},
 				[]Instructions{
-					Make(OpGetLocal, 0),
+					Make(OpBoxLocal, 0),
 					Make(OpClosure, 0, 1),
 					Make(OpReturnValue),
 				},
@@ -752,13 +1036,13 @@ fn(a) {
 					Make(OpReturnValue),
 				},
 				[]Instructions{
-					Make(OpGetFree, 0),
-					Make(OpGetLocal, 0),
+					Make(OpBoxFree, 0),
+					Make(OpBoxLocal, 0),
 					Make(OpClosure, 0, 2),
 					Make(OpReturnValue),
 				},
 				[]Instructions{
-					Make(OpGetLocal, 0),
+					Make(OpBoxLocal, 0),
 					Make(OpClosure, 1, 1),
 					Make(OpReturnValue),
 				},
@@ -805,15 +1089,15 @@ fn () {
 				[]Instructions{
 					Make(OpConstant, 2),
 					Make(OpSetLocal, 0),
-					Make(OpGetFree, 0),
-					Make(OpGetLocal, 0),
+					Make(OpBoxFree, 0),
+					Make(OpBoxLocal, 0),
 					Make(OpClosure, 4, 2),
 					Make(OpReturnValue),
 				},
 				[]Instructions{
 					Make(OpConstant, 1),
 					Make(OpSetLocal, 0),
-					Make(OpGetLocal, 0),
+					Make(OpBoxLocal, 0),
 					Make(OpClosure, 5, 1),
 					Make(OpReturnValue),
 				},
@@ -829,6 +1113,141 @@ fn () {
 	runCompilerTest(t, tests)
 }
 
+func TestAssignCompile(t *testing.T) {
+	tests := []compilerTestCase{
+		{`let x = 1; x += 2`, []any{1, 2}, []Instructions{
+			Make(OpConstant, 0),  // 0000
+			Make(OpSetGlobal, 0), // 0003
+			Make(OpGetGlobal, 0), // 0006
+			Make(OpConstant, 1),  // 0009
+			Make(OpAdd),          // 0012
+			Make(OpSetGlobal, 0), // 0013
+			Make(OpGetGlobal, 0), // 0016
+			Make(OpPop),          // 0019
+		}},
+		{
+			input: `fn(a, b) { fn(x) { b = b + x } }`,
+			expectedConstants: []any{
+				[]Instructions{
+					Make(OpGetFree, 0),
+					Make(OpGetLocal, 0),
+					Make(OpAdd),
+					Make(OpSetFree, 0),
+					Make(OpGetFree, 0),
+					Make(OpReturnValue),
+				},
+				[]Instructions{
+					Make(OpBoxLocal, 1),
+					Make(OpClosure, 0, 1),
+					Make(OpReturnValue),
+				},
+			},
+			expectedInstructions: []Instructions{
+				Make(OpClosure, 1, 0),
+				Make(OpPop),
+			},
+		},
+		{
+			input: `fn(a) { a = 2 }`,
+			expectedConstants: []any{
+				2,
+				[]Instructions{
+					Make(OpConstant, 0),
+					Make(OpSetLocal, 0),
+					Make(OpGetLocal, 0),
+					Make(OpReturnValue),
+				},
+			},
+			expectedInstructions: []Instructions{
+				Make(OpClosure, 1, 0),
+				Make(OpPop),
+			},
+		},
+	}
+	runCompilerTest(t, tests)
+
+	for _, input := range []string{"x = 1", "len = 1", "let f = fn() { f = 1 }"} {
+		if err := New().Compile(parse(input)); err == nil {
+			t.Errorf("%s: expected a compile error", input)
+		}
+	}
+}
+
+func TestWideJumpsCompile(t *testing.T) {
+	// the body of the if is more than 64KB of instructions
+	body := strings.Repeat("1; ", 20000)
+	compiler := New()
+	if err := compiler.Compile(parse("if (true) { fn() {}; " + body + "}; 2")); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	ins := compiler.Bytecode().Instructions
+	if Opcode(ins[0]) != OpTrue || Opcode(ins[1]) != OpWide || Opcode(ins[2]) != OpJumpIfFalsy {
+		t.Fatalf("jump is not wide. got=%q", ins[:8].String())
+	}
+	if len(compiler.Bytecode().Constants) != 3 {
+		t.Errorf("constants of the narrow attempt kept. got=%d", len(compiler.Bytecode().Constants))
+	}
+
+	compiler = New()
+	if err := compiler.Compile(parse("if (true) { " + strings.Repeat("1; ", 30000) + "}")); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	if stats := compiler.ConstantPool().Stats(); stats != (PoolStats{Size: 1, Added: 1, Reused: 29999}) {
+		t.Errorf("counts of the narrow attempt kept. got=%+v", stats)
+	}
+
+	compiler = New()
+	input := "let a = 1; if (true) { try { 1 } catch (e) { e }; " + body + "}; let b = 2;"
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	if sym, _ := compiler.symbolTable.Resolve("b"); sym.Index != 2 || compiler.symbolTable.numdef != 3 {
+		t.Errorf("symbols of the narrow attempt kept. want b at 2 of 3 got=%d of %d",
+			sym.Index, compiler.symbolTable.numdef)
+	}
+}
+
+func TestCompile_limits(t *testing.T) {
+	lets := func(n int) string {
+		var sb strings.Builder
+		for i := range n {
+			fmt.Fprintf(&sb, "let a%d = 0; ", i)
+		}
+		return sb.String()
+	}
+	names := func(n int) string {
+		var sb strings.Builder
+		for i := range n {
+			fmt.Fprintf(&sb, "a%d, ", i)
+		}
+		return sb.String()
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn() {}; f(" + strings.Repeat("0, ", MaxArgs) + "0)",
+			fmt.Sprintf("too many arguments: %d, the limit is %d", MaxArgs+1, MaxArgs)},
+		{"fn() { " + lets(MaxLocals+1) + "}",
+			fmt.Sprintf("too many locals: %d, the limit is %d", MaxLocals+1, MaxLocals)},
+		{lets(GlobalSize + 1),
+			fmt.Sprintf("too many globals: %d, the limit is %d", GlobalSize+1, GlobalSize)},
+		{"fn() { " + lets(MaxFree+1) + "fn() { [" + names(MaxFree+1) + "] } }",
+			fmt.Sprintf("too many free variables: %d, the limit is %d", MaxFree+1, MaxFree)},
+	}
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong compile error. want=%q got=%v", tt.expected, err)
+		}
+	}
+
+	compiler := New()
+	if _, err := compiler.emit(OpConstant, 1<<32); err == nil || len(compiler.scope().instructions) != 0 {
+		t.Errorf("operand past the wide width emitted. got=%v", err)
+	}
+}
+
 func TestClosure_4recursiveCompile(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -842,13 +1261,13 @@ func TestClosure_4recursiveCompile(t *testing.T) {
 					Make(OpSub),
 					Make(OpCall, 1),
 					Make(OpReturnValue),
-				}, 1,
+				},
 			},
 			expectedInstructions: []Instructions{
 				Make(OpClosure, 1, 0),
 				Make(OpSetGlobal, 0),
 				Make(OpGetGlobal, 0),
-				Make(OpConstant, 2),
+				Make(OpConstant, 0),
 				Make(OpCall, 1),
 				Make(OpPop),
 			},
@@ -870,18 +1289,18 @@ func TestClosure_4recursiveCompile(t *testing.T) {
 					Make(OpSub),
 					Make(OpCall, 1),
 					Make(OpReturnValue),
-				}, 1,
+				},
 				[]Instructions{
 					Make(OpClosure, 1, 0),
 					Make(OpSetLocal, 0),
 					Make(OpGetLocal, 0),
-					Make(OpConstant, 2),
+					Make(OpConstant, 0),
 					Make(OpCall, 1),
 					Make(OpReturnValue),
 				},
 			},
 			expectedInstructions: []Instructions{
-				Make(OpClosure, 3, 0),
+				Make(OpClosure, 2, 0),
 				Make(OpSetGlobal, 0),
 				Make(OpGetGlobal, 0),
 				Make(OpCall, 0),
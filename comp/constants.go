@@ -0,0 +1,116 @@
+package comp
+
+import (
+	"compgo/interp"
+	"math"
+)
+
+// ConstantPool holds the constants of compiled code. Numbers and strings
+// are deduplicated by type and value, compiled functions are not.
+type ConstantPool struct {
+	objects []interp.Object
+	index   map[constantKey]int
+	added   int
+	reused  int
+}
+
+// constantKey identifies a deduplicated constant: num holds integers and
+// the bits of floats, str strings and big integers.
+type constantKey struct {
+	typ interp.ObjectType
+	num uint64
+	str string
+}
+
+// PoolStats describes the constants of a ConstantPool.
+type PoolStats struct {
+	// Size is the number of constants in the pool.
+	Size int
+	// Added counts the constants Add put in the pool, Reused those it
+	// found there already.
+	Added, Reused int
+	// Wide is the number of constants past the 2-byte OpConstant operand,
+	// which are loaded with OpWide.
+	Wide int
+}
+
+func NewConstantPool() *ConstantPool {
+	return &ConstantPool{objects: []interp.Object{}, index: map[constantKey]int{}}
+}
+
+// NewConstantPoolFrom returns a pool holding objs at their indexes.
+func NewConstantPoolFrom(objs []interp.Object) *ConstantPool {
+	p := NewConstantPool()
+	for _, obj := range objs {
+		if key, ok := keyOf(obj); ok {
+			if _, dup := p.index[key]; !dup {
+				p.index[key] = len(p.objects)
+			}
+		}
+		p.objects = append(p.objects, obj)
+	}
+	return p
+}
+
+// Add returns the index of obj in the pool, adding it unless an equal
+// constant is already there.
+func (p *ConstantPool) Add(obj interp.Object) int {
+	key, ok := keyOf(obj)
+	if ok {
+		if idx, found := p.index[key]; found {
+			p.reused++
+			return idx
+		}
+		p.index[key] = len(p.objects)
+	}
+	p.added++
+	p.objects = append(p.objects, obj)
+	return len(p.objects) - 1
+}
+
+// Objects returns the constants in index order. The slice is shared with
+// the pool, which only ever appends to it.
+func (p *ConstantPool) Objects() []interp.Object { return p.objects }
+
+func (p *ConstantPool) Len() int { return len(p.objects) }
+
+func (p *ConstantPool) Stats() PoolStats {
+	wide := len(p.objects) - math.MaxUint16 - 1
+	return PoolStats{Size: len(p.objects), Added: p.added, Reused: p.reused, Wide: max(wide, 0)}
+}
+
+// poolMark records the size and counters of a ConstantPool.
+type poolMark struct {
+	size, added, reused int
+}
+
+func (p *ConstantPool) mark() poolMark {
+	return poolMark{len(p.objects), p.added, p.reused}
+}
+
+// truncate drops the constants added since m, by a compilation attempt
+// thrown away, and restores the counters of m.
+func (p *ConstantPool) truncate(m poolMark) {
+	for key, idx := range p.index {
+		if idx >= m.size {
+			delete(p.index, key)
+		}
+	}
+	p.objects = p.objects[:m.size]
+	p.added, p.reused = m.added, m.reused
+}
+
+func keyOf(obj interp.Object) (constantKey, bool) {
+	switch o := obj.(type) {
+	case *interp.Integer:
+		return constantKey{typ: o.Type(), num: uint64(o.Value)}, true
+	case *interp.Float:
+		// by bits, so 0.0 and -0.0 stay apart
+		return constantKey{typ: o.Type(), num: math.Float64bits(o.Value)}, true
+	case *interp.String:
+		return constantKey{typ: o.Type(), str: o.Value}, true
+	case *interp.BigInteger:
+		return constantKey{typ: o.Type(), str: o.Value.String()}, true
+	}
+	return constantKey{}, false
+}
@@ -0,0 +1,70 @@
+package comp
+
+import (
+	"compgo/interp"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestConstantPool(t *testing.T) {
+	integer := func(i int) interp.Object { return &interp.Integer{Primitive: interp.Primitive[int]{Value: i}} }
+	float := func(f float64) interp.Object { return &interp.Float{Primitive: interp.Primitive[float64]{Value: f}} }
+	str := func(s string) interp.Object { return &interp.String{Primitive: interp.Primitive[string]{Value: s}} }
+	huge, _ := new(big.Int).SetString("99999999999999999999", 10)
+
+	pool := NewConstantPool()
+	tests := []struct {
+		obj      interp.Object
+		expected int
+	}{
+		{integer(1), 0},
+		{float(1), 1},
+		{str("1"), 2},
+		{integer(1), 0},
+		{str("異世界"), 3},
+		{str("1"), 2},
+		{float(0), 4},
+		{float(math.Copysign(0, -1)), 5},
+		{float(1), 1},
+		{interp.NewBigInteger(huge), 6},
+		{interp.NewBigInteger(new(big.Int).Set(huge)), 6},
+		{&CompiledFunction{}, 7},
+		{&CompiledFunction{}, 8},
+	}
+	for _, tt := range tests {
+		if idx := pool.Add(tt.obj); idx != tt.expected {
+			t.Errorf("wrong index for %s. want=%d got=%d", tt.obj.Inspect(), tt.expected, idx)
+		}
+	}
+	expected := PoolStats{Size: 9, Added: 9, Reused: 4}
+	if stats := pool.Stats(); stats != expected {
+		t.Errorf("wrong stats. want=%+v got=%+v", expected, stats)
+	}
+
+	pool.truncate(poolMark{size: 3, added: 3, reused: 1})
+	if stats := pool.Stats(); stats != (PoolStats{Size: 3, Added: 3, Reused: 1}) {
+		t.Errorf("wrong stats after truncate. got=%+v", stats)
+	}
+	if idx := pool.Add(float(0)); idx != 3 {
+		t.Errorf("truncated constant still indexed. got=%d", idx)
+	}
+	if idx := pool.Add(str("1")); idx != 2 {
+		t.Errorf("constant kept by truncate not indexed. got=%d", idx)
+	}
+
+	from := NewConstantPoolFrom([]interp.Object{integer(5), integer(5), str("a")})
+	if from.Len() != 3 {
+		t.Errorf("constants not kept at their index. got=%d", from.Len())
+	}
+	if idx := from.Add(integer(5)); idx != 0 {
+		t.Errorf("wrong index for existing constant. want=0 got=%d", idx)
+	}
+
+	for i := range math.MaxUint16 + 2 {
+		from.Add(integer(i))
+	}
+	if wide := from.Stats().Wide; wide != 3 {
+		t.Errorf("wrong number of wide constants. want=3 got=%d", wide)
+	}
+}
@@ -0,0 +1,336 @@
+package comp
+
+import (
+	"bufio"
+	"bytes"
+	"compgo/interp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+)
+
+const (
+	bytecodeMagic   = "CGBC"
+	BytecodeVersion = 3
+)
+
+const (
+	tagInteger byte = iota + 1
+	tagString
+	tagCompiledFunction
+	tagFloat
+	tagBigInteger
+)
+
+var (
+	ErrBadMagic  = errors.New("bytecode: bad magic header")
+	ErrTruncated = errors.New("bytecode: truncated input")
+	ErrBadWide   = errors.New("bytecode: OpWide before an instruction without operands")
+)
+
+type VersionError struct {
+	Version uint16
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("bytecode: unsupported version %d, want=%d",
+		e.Version, BytecodeVersion)
+}
+
+type UnknownOpcodeError struct {
+	Op     byte
+	Offset int
+}
+
+func (e *UnknownOpcodeError) Error() string {
+	return fmt.Sprintf("bytecode: unknown opcode %d at offset %d", e.Op, e.Offset)
+}
+
+type ConstantIndexError struct {
+	Index, Len int
+	Offset     int
+}
+
+func (e *ConstantIndexError) Error() string {
+	return fmt.Sprintf("bytecode: constant index %d out of range (pool size %d) at offset %d",
+		e.Index, e.Len, e.Offset)
+}
+
+type UnknownConstantError struct {
+	Tag byte
+}
+
+func (e *UnknownConstantError) Error() string {
+	return fmt.Sprintf("bytecode: unknown constant tag %d", e.Tag)
+}
+
+type UnsupportedConstantError struct {
+	Object interp.Object
+}
+
+func (e *UnsupportedConstantError) Error() string {
+	return fmt.Sprintf("bytecode: cannot encode constant of type %s", e.Object.Type())
+}
+
+// Encode writes b to w prefixed with the magic header and BytecodeVersion.
+func Encode(w io.Writer, b *Bytecode) error {
+	var buf bytes.Buffer
+	buf.WriteString(bytecodeMagic)
+	buf.Write(binary.BigEndian.AppendUint16(nil, BytecodeVersion))
+	buf.Write(binary.AppendUvarint(nil, uint64(len(b.Constants))))
+	for _, c := range b.Constants {
+		if err := encodeConstant(&buf, c); err != nil {
+			return err
+		}
+	}
+	writeBytes(&buf, []byte(b.File))
+	writeBytes(&buf, b.Instructions)
+	writeSourceMap(&buf, b.SourceMap)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeBytes(buf *bytes.Buffer, p []byte) {
+	buf.Write(binary.AppendUvarint(nil, uint64(len(p))))
+	buf.Write(p)
+}
+
+func writeSourceMap(buf *bytes.Buffer, m SourceMap) {
+	buf.Write(binary.AppendUvarint(nil, uint64(len(m))))
+	for _, sp := range m {
+		buf.Write(binary.AppendUvarint(nil, uint64(sp.Offset)))
+		buf.Write(binary.AppendUvarint(nil, uint64(sp.Line)))
+		buf.Write(binary.AppendUvarint(nil, uint64(sp.Column)))
+	}
+}
+
+func encodeConstant(buf *bytes.Buffer, o interp.Object) error {
+	switch c := o.(type) {
+	case *interp.Integer:
+		buf.WriteByte(tagInteger)
+		buf.Write(binary.AppendVarint(nil, int64(c.Value)))
+	case *interp.Float:
+		buf.WriteByte(tagFloat)
+		buf.Write(binary.AppendUvarint(nil, math.Float64bits(c.Value)))
+	case *interp.BigInteger:
+		buf.WriteByte(tagBigInteger)
+		writeBytes(buf, []byte(c.Value.String()))
+	case *interp.String:
+		buf.WriteByte(tagString)
+		writeBytes(buf, []byte(c.Value))
+	case *CompiledFunction:
+		buf.WriteByte(tagCompiledFunction)
+		buf.Write(binary.AppendUvarint(nil, uint64(c.NumLocals)))
+		buf.Write(binary.AppendUvarint(nil, uint64(c.NumArgs)))
+		writeBytes(buf, []byte(c.Name))
+		writeBytes(buf, []byte(c.File))
+		writeBytes(buf, c.Instructions)
+		writeSourceMap(buf, c.SourceMap)
+	default:
+		return &UnsupportedConstantError{o}
+	}
+	return nil
+}
+
+type bytecodeReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// Decode reads bytecode written by Encode and validates its instructions
+// against the opcode definitions and the constant pool.
+func Decode(r io.Reader) (*Bytecode, error) {
+	br, ok := r.(bytecodeReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	header := make([]byte, len(bytecodeMagic)+2)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, truncated(err)
+	}
+	if string(header[:len(bytecodeMagic)]) != bytecodeMagic {
+		return nil, ErrBadMagic
+	}
+	if v := binary.BigEndian.Uint16(header[len(bytecodeMagic):]); v != BytecodeVersion {
+		return nil, &VersionError{v}
+	}
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, truncated(err)
+	}
+	b := &Bytecode{Constants: []interp.Object{}}
+	for range count {
+		c, err := decodeConstant(br)
+		if err != nil {
+			return nil, err
+		}
+		b.Constants = append(b.Constants, c)
+	}
+	file, err := readBytes(br)
+	if err != nil {
+		return nil, err
+	}
+	b.File = string(file)
+	if b.Instructions, err = readBytes(br); err != nil {
+		return nil, err
+	}
+	if b.SourceMap, err = readSourceMap(br); err != nil {
+		return nil, err
+	}
+	if err := validateInstructions(b.Instructions, len(b.Constants)); err != nil {
+		return nil, err
+	}
+	for _, c := range b.Constants {
+		fn, ok := c.(*CompiledFunction)
+		if !ok {
+			continue
+		}
+		if err := validateInstructions(fn.Instructions, len(b.Constants)); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrTruncated
+	}
+	return err
+}
+
+func readBytes(r bytecodeReader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, truncated(err)
+	}
+	// copying instead of allocating n upfront so a corrupted length
+	// cannot ask for more memory than the input actually has.
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		return nil, truncated(err)
+	}
+	return buf.Bytes(), nil
+}
+
+func readSourceMap(r bytecodeReader) (SourceMap, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, truncated(err)
+	}
+	m := SourceMap{}
+	for range n {
+		var fields [3]uint64
+		for i := range fields {
+			if fields[i], err = binary.ReadUvarint(r); err != nil {
+				return nil, truncated(err)
+			}
+		}
+		m = append(m, SourcePos{int(fields[0]), int(fields[1]), int(fields[2])})
+	}
+	return m, nil
+}
+
+func decodeConstant(r bytecodeReader) (interp.Object, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, truncated(err)
+	}
+	switch tag {
+	case tagInteger:
+		v, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, truncated(err)
+		}
+		return &interp.Integer{Primitive: interp.Primitive[int]{Value: int(v)}}, nil
+	case tagFloat:
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, truncated(err)
+		}
+		return &interp.Float{Primitive: interp.Primitive[float64]{Value: math.Float64frombits(v)}}, nil
+	case tagBigInteger:
+		s, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		v, ok := new(big.Int).SetString(string(s), 10)
+		if !ok {
+			return nil, fmt.Errorf("bytecode: invalid big integer constant %q", s)
+		}
+		return interp.NewBigInteger(v), nil
+	case tagString:
+		s, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		return &interp.String{Primitive: interp.Primitive[string]{Value: string(s)}}, nil
+	case tagCompiledFunction:
+		numLocals, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, truncated(err)
+		}
+		numArgs, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, truncated(err)
+		}
+		fn := &CompiledFunction{NumLocals: int(numLocals), NumArgs: int(numArgs)}
+		name, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		file, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		fn.Name, fn.File = string(name), string(file)
+		if fn.Instructions, err = readBytes(r); err != nil {
+			return nil, err
+		}
+		if fn.SourceMap, err = readSourceMap(r); err != nil {
+			return nil, err
+		}
+		return fn, nil
+	default:
+		return nil, &UnknownConstantError{tag}
+	}
+}
+
+func validateInstructions(ins Instructions, numConstants int) error {
+	for addr := 0; addr < len(ins); {
+		start := addr
+		scale := 1
+		if Opcode(ins[addr]) == OpWide {
+			scale = 2
+			addr++
+			if addr == len(ins) {
+				return fmt.Errorf("%w: OpWide at offset %d", ErrTruncated, start)
+			}
+		}
+		def, err := Lookup(ins[addr])
+		if err != nil {
+			return &UnknownOpcodeError{ins[addr], addr}
+		}
+		op := Opcode(ins[addr])
+		if scale == 2 && len(def.OperandWidth) == 0 {
+			return fmt.Errorf("%w: %s at offset %d", ErrBadWide, def.Name, start)
+		}
+		addr++
+		for i, w := range def.OperandWidth {
+			w *= scale
+			if addr+w > len(ins) {
+				return fmt.Errorf("%w: operand of %s at offset %d",
+					ErrTruncated, def.Name, start)
+			}
+			opr := ReadOperand(ins[addr:], w)
+			addr += w
+			if i == 0 && (op == OpConstant || op == OpClosure) && opr >= numConstants {
+				return &ConstantIndexError{opr, numConstants, start}
+			}
+		}
+	}
+	return nil
+}
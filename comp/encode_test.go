@@ -0,0 +1,175 @@
+package comp
+
+import (
+	"bytes"
+	"compgo/interp"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func encodeInput(t *testing.T, input string) (*Bytecode, []byte) {
+	t.Helper()
+	compiler := New()
+	compiler.SetFile("encode.mk")
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	bc := compiler.Bytecode()
+	var buf bytes.Buffer
+	if err := Encode(&buf, bc); err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	return bc, buf.Bytes()
+}
+
+func TestEncodeDecode_roundTrip(t *testing.T) {
+	tests := []vmTestCase{
+		{`1 + 2 * -3`, -5},
+		{`"異" + "世界"`, "異世界"},
+		{`1.5 * -2e-3`, -0.003},
+		{`99999999999999999999 - 99999999999999999998`, 1},
+		{`let adder = fn(base) {
+			fn(add) { base + add; };
+		}; adder(10)(5)`, 15},
+		{`let fibonacci = fn(x) {
+			if (x < 2) { return x; }
+			fibonacci(x - 1) + fibonacci(x - 2)
+		}; fibonacci(10)`, 55},
+		{`len(["異", "世", "界"])`, 3},
+	}
+	for _, tt := range tests {
+		bc, raw := encodeInput(t, tt.input)
+		decoded, err := Decode(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("decode error: %s", err)
+		}
+		if decoded.Instructions.String() != bc.Instructions.String() {
+			t.Errorf("instructions differ.\nwant=%q\ngot=%q",
+				bc.Instructions, decoded.Instructions)
+		}
+		if !reflect.DeepEqual(decoded.SourceMap, bc.SourceMap) {
+			t.Errorf("source map differs.\nwant=%v\ngot=%v", bc.SourceMap, decoded.SourceMap)
+		}
+		if len(decoded.Constants) != len(bc.Constants) {
+			t.Fatalf("wrong number of constants. want=%d got=%d",
+				len(bc.Constants), len(decoded.Constants))
+		}
+		for i, c := range bc.Constants {
+			if fn, ok := c.(*CompiledFunction); ok {
+				dfn, ok := decoded.Constants[i].(*CompiledFunction)
+				if !ok {
+					t.Fatalf("constant %d is not function. got=%T", i, decoded.Constants[i])
+				}
+				if dfn.NumArgs != fn.NumArgs || dfn.NumLocals != fn.NumLocals ||
+					dfn.Name != fn.Name || dfn.File != fn.File ||
+					!reflect.DeepEqual(dfn.SourceMap, fn.SourceMap) ||
+					dfn.Instructions.String() != fn.Instructions.String() {
+					t.Errorf("constant %d function differs. want=%+v got=%+v", i, fn, dfn)
+				}
+				continue
+			}
+			if decoded.Constants[i].Inspect() != c.Inspect() {
+				t.Errorf("constant %d differs. want=%s got=%s",
+					i, c.Inspect(), decoded.Constants[i].Inspect())
+			}
+		}
+		vm := NewVm(decoded)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPop())
+	}
+}
+
+func TestDecode_truncated(t *testing.T) {
+	_, raw := encodeInput(t, `let f = fn(a) { a + "世界" }; f("異")`)
+	for i := range len(raw) {
+		_, err := Decode(bytes.NewReader(raw[:i]))
+		if !errors.Is(err, ErrTruncated) {
+			t.Errorf("decoding %d of %d bytes. want ErrTruncated got=%v",
+				i, len(raw), err)
+		}
+	}
+}
+
+func TestDecode_invalid(t *testing.T) {
+	encode := func(bc *Bytecode) []byte {
+		var buf bytes.Buffer
+		if err := Encode(&buf, bc); err != nil {
+			t.Fatalf("encode error: %s", err)
+		}
+		return buf.Bytes()
+	}
+	one := &interp.Integer{Primitive: interp.Primitive[int]{Value: 1}}
+
+	_, err := Decode(bytes.NewReader([]byte("MONKEY")))
+	if !errors.Is(err, ErrBadMagic) {
+		t.Errorf("want ErrBadMagic got=%v", err)
+	}
+
+	raw := encode(&Bytecode{Instructions: Make(OpNull)})
+	raw[len(bytecodeMagic)+1] = BytecodeVersion + 1
+	var verr *VersionError
+	if _, err := Decode(bytes.NewReader(raw)); !errors.As(err, &verr) {
+		t.Errorf("want VersionError got=%v", err)
+	}
+	// version 2 had no floats, big integers nor OpWide
+	raw[len(bytecodeMagic)+1] = 2
+	if _, err := Decode(bytes.NewReader(raw)); !errors.As(err, &verr) || verr.Version != 2 {
+		t.Errorf("want VersionError for version 2 got=%v", err)
+	}
+
+	raw = encode(&Bytecode{Instructions: Instructions{byte(OpNull), 250}})
+	var operr *UnknownOpcodeError
+	if _, err := Decode(bytes.NewReader(raw)); !errors.As(err, &operr) {
+		t.Errorf("want UnknownOpcodeError got=%v", err)
+	} else if operr.Op != 250 || operr.Offset != 1 {
+		t.Errorf("wrong opcode error. got=%+v", operr)
+	}
+
+	fn := &CompiledFunction{Instructions: Make(OpConstant, 2)}
+	raw = encode(&Bytecode{
+		Instructions: Make(OpConstant, 0),
+		Constants:    []interp.Object{one, fn},
+	})
+	var cerr *ConstantIndexError
+	if _, err := Decode(bytes.NewReader(raw)); !errors.As(err, &cerr) {
+		t.Errorf("want ConstantIndexError got=%v", err)
+	} else if cerr.Index != 2 || cerr.Len != 2 {
+		t.Errorf("wrong constant index error. got=%+v", cerr)
+	}
+
+	raw = encode(&Bytecode{Instructions: Make(OpClosure, 5, 0)})
+	if _, err := Decode(bytes.NewReader(raw)); !errors.As(err, &cerr) {
+		t.Errorf("want ConstantIndexError got=%v", err)
+	}
+
+	raw = encode(&Bytecode{Instructions: Make(OpConstant, 0)[:2], Constants: []interp.Object{one}})
+	if _, err := Decode(bytes.NewReader(raw)); !errors.Is(err, ErrTruncated) {
+		t.Errorf("want ErrTruncated for short operand got=%v", err)
+	}
+
+	raw = encode(&Bytecode{Instructions: Make(OpConstant, 65536), Constants: []interp.Object{one}})
+	if _, err := Decode(bytes.NewReader(raw)); !errors.As(err, &cerr) {
+		t.Errorf("want ConstantIndexError for wide operand got=%v", err)
+	} else if cerr.Index != 65536 {
+		t.Errorf("wrong constant index error. got=%+v", cerr)
+	}
+
+	raw = encode(&Bytecode{Instructions: Make(OpGetLocal, 300)[:3]})
+	if _, err := Decode(bytes.NewReader(raw)); !errors.Is(err, ErrTruncated) {
+		t.Errorf("want ErrTruncated for short wide operand got=%v", err)
+	}
+
+	raw = encode(&Bytecode{Instructions: Instructions{byte(OpWide), byte(OpNull)}})
+	if _, err := Decode(bytes.NewReader(raw)); !errors.Is(err, ErrBadWide) {
+		t.Errorf("want ErrBadWide got=%v", err)
+	}
+
+	err = Encode(&bytes.Buffer{}, &Bytecode{Constants: []interp.Object{interp.TrueObject}})
+	var uerr *UnsupportedConstantError
+	if !errors.As(err, &uerr) {
+		t.Errorf("want UnsupportedConstantError got=%v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package comp
+
+import (
+	"compgo/interp"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TraceFrame is a single active frame at the time a runtime error happens.
+type TraceFrame struct {
+	Function string
+	Position
+}
+
+func (t TraceFrame) String() string {
+	return fmt.Sprintf("%s (%s)", t.Function, t.Position)
+}
+
+// RuntimeError is returned by Vm.Run. Op is the instruction that failed
+// and the trace starts at the innermost frame.
+type RuntimeError struct {
+	Kind   interp.ErrorKind
+	Op     Opcode
+	Err    error
+	Values []interp.Object
+	Trace  []TraceFrame
+}
+
+func newRuntimeError(kind interp.ErrorKind, msg string, values ...interp.Object) *RuntimeError {
+	return &RuntimeError{Kind: kind, Err: errors.New(msg), Values: values}
+}
+
+func (e *RuntimeError) Error() string {
+	var sb strings.Builder
+	if len(e.Trace) > 0 && e.Trace[0].IsValid() {
+		sb.WriteString(e.Trace[0].Position.String())
+		sb.WriteString(": ")
+	}
+	sb.WriteString(e.Err.Error())
+	for i := 0; i < len(e.Trace); {
+		f := e.Trace[i]
+		sb.WriteString("\n\tat ")
+		sb.WriteString(f.String())
+		// collapse the repeated frames of a recursion
+		n := 1
+		for i+n < len(e.Trace) && e.Trace[i+n] == f {
+			n++
+		}
+		if n > 1 {
+			fmt.Fprintf(&sb, "\n\t... repeated %d more times", n-1)
+		}
+		i += n
+	}
+	return sb.String()
+}
+
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// Object returns the error as the script sees it in a catch block.
+func (e *RuntimeError) Object() *interp.Error {
+	obj := &interp.Error{Msg: e.Err.Error(), Kind: e.Kind}
+	if e.Kind == interp.KindThrown && len(e.Values) > 0 {
+		obj.Value = e.Values[0]
+	}
+	return obj
+}
+
+// Position returns where the error happened.
+func (e *RuntimeError) Position() Position {
+	if len(e.Trace) == 0 {
+		return Position{}
+	}
+	return e.Trace[0].Position
+}
+
+// runtimeError completes err with the failing opcode and the frame chain.
+func (vm *Vm) runtimeError(err error) *RuntimeError {
+	rerr, ok := err.(*RuntimeError)
+	if !ok {
+		rerr = &RuntimeError{Kind: interp.KindInternal, Err: err}
+		if errors.Is(err, ErrEmptyStack) {
+			rerr.Kind = interp.KindStackUnderflow
+		}
+	}
+	rerr.Op = vm.op
+	rerr.Trace = vm.trace()
+	return rerr
+}
+
+func (vm *Vm) trace() []TraceFrame {
+	trace := make([]TraceFrame, 0, vm.frameIdx)
+	for i := vm.frameIdx - 1; i >= 0; i-- {
+		f := vm.frames[i]
+		name := f.cl.Fn.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		trace = append(trace, TraceFrame{name, f.cl.Fn.Position(f.ip - 1)})
+	}
+	return trace
+}
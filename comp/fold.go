@@ -0,0 +1,144 @@
+package comp
+
+import (
+	"compgo/interp"
+	"math"
+	"strconv"
+)
+
+// Fold replaces the operations on literals in node by their value, unless
+// they fail or depend on the VM options, and decided ifs by their branch.
+// Like interp.Modify, it rewrites node in place and returns it.
+func Fold(node interp.Node) interp.Node {
+	return interp.Modify(node, fold)
+}
+
+func fold(node interp.Node) interp.Node {
+	switch n := node.(type) {
+	case *interp.Program:
+		n.Statements = foldStatements(n.Statements)
+	case *interp.BlockStatement:
+		n.Statements = foldStatements(n.Statements)
+	case *interp.InfixExpression:
+		return foldInfix(n)
+	case *interp.PrefixExpression:
+		return foldPrefix(n)
+	case *interp.IfExpression:
+		// a branch of a single expression is that expression
+		if taken, ok := decidedBranch(n); ok && len(taken) == 1 {
+			if es, ok := taken[0].(*interp.ExpressionStatement); ok && es.Expression != nil {
+				return es.Expression
+			}
+		}
+	case *interp.CallExpression:
+		// Modify leaves the calls to the modifier
+		n.Func = Fold(n.Func).(interp.Expression)
+		for i, arg := range n.Args {
+			n.Args[i] = Fold(arg).(interp.Expression)
+		}
+	}
+	return node
+}
+
+// foldStatements splices the branch of a decided if into stmts unless that
+// changes the value of the block.
+func foldStatements(stmts []interp.Statement) []interp.Statement {
+	folded := make([]interp.Statement, 0, len(stmts))
+	for i, s := range stmts {
+		if es, ok := s.(*interp.ExpressionStatement); ok {
+			if ie, ok := es.Expression.(*interp.IfExpression); ok {
+				taken, ok := decidedBranch(ie)
+				if ok && (i < len(stmts)-1 || endsWithExpression(taken)) {
+					folded = append(folded, taken...)
+					continue
+				}
+			}
+		}
+		folded = append(folded, s)
+	}
+	return folded
+}
+
+// decidedBranch returns the statements of the branch taken by ie when its
+// condition is a literal.
+func decidedBranch(ie *interp.IfExpression) ([]interp.Statement, bool) {
+	if !isLiteral(ie.Condition) {
+		return nil, false
+	}
+	taken := ie.Then
+	if !interp.IsTruthy(interp.Eval(ie.Condition, interp.NewEnvironment())) {
+		taken = ie.Else
+	}
+	if taken == nil {
+		return nil, true
+	}
+	return taken.Statements, true
+}
+
+func endsWithExpression(stmts []interp.Statement) bool {
+	if len(stmts) == 0 {
+		return false
+	}
+	es, ok := stmts[len(stmts)-1].(*interp.ExpressionStatement)
+	return ok && es.Expression != nil
+}
+
+func foldInfix(n *interp.InfixExpression) interp.Expression {
+	if !isLiteral(n.Left) || !isLiteral(n.Right) {
+		return n
+	}
+	if l, ok := n.Left.(*interp.IntLiteral); ok {
+		if r, ok := n.Right.(*interp.IntLiteral); ok && interp.Overflows(n.Operator, l.Value, r.Value) {
+			return n
+		}
+	}
+	_, lstr := n.Left.(*interp.StringLiteral)
+	_, rstr := n.Right.(*interp.StringLiteral)
+	if (lstr || rstr) && orderingOps[n.Operator] {
+		return n
+	}
+	return foldedLiteral(n, n.Token)
+}
+
+func foldPrefix(n *interp.PrefixExpression) interp.Expression {
+	if !isLiteral(n.Right) {
+		return n
+	}
+	if i, ok := n.Right.(*interp.IntLiteral); ok && n.Operator == "-" && i.Value == math.MinInt {
+		return n
+	}
+	return foldedLiteral(n, n.Token)
+}
+
+var orderingOps = map[string]bool{"<": true, ">": true, "<=": true, ">=": true}
+
+func isLiteral(e interp.Expression) bool {
+	switch e.(type) {
+	case *interp.IntLiteral, *interp.FloatLiteral, *interp.StringLiteral, *interp.BooleanLiteral:
+		return true
+	}
+	return false
+}
+
+// foldedLiteral evaluates e and returns its value as a literal at the
+// position of tok, or e itself when it fails.
+func foldedLiteral(e interp.Expression, tok interp.Token) interp.Expression {
+	switch o := interp.Eval(e, interp.NewEnvironment()).(type) {
+	case *interp.Integer:
+		tok.Type, tok.Literal = interp.Int, strconv.Itoa(o.Value)
+		return &interp.IntLiteral{Token: tok, Value: o.Value}
+	case *interp.Float:
+		tok.Type, tok.Literal = interp.Flt, o.Inspect()
+		return &interp.FloatLiteral{Token: tok, Value: o.Value}
+	case *interp.String:
+		tok.Type, tok.Literal = interp.Str, o.Value
+		return &interp.StringLiteral{Token: tok, Value: o.Value}
+	case *interp.Boolean:
+		tok.Type, tok.Literal = interp.False, "false"
+		if o.Value {
+			tok.Type, tok.Literal = interp.True, "true"
+		}
+		return &interp.BooleanLiteral{Token: tok, Value: o.Value}
+	}
+	return e
+}
@@ -0,0 +1,135 @@
+package comp
+
+import (
+	"compgo/interp"
+	"errors"
+	"testing"
+)
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`2 * 60 * 60`, `7200`},
+		{`-(1 + 2)`, `-3`},
+		{`1.5 * 2`, `3.0`},
+		{`"a" + "b" + c`, `(ab+c)`},
+		{`"a" == "a"`, `true`},
+		{`!(1 < 2) || false`, `false`},
+		{`x + 1 + 2`, `((x+1)+2)`},
+		{`f(1 + 1)`, `f(2)`},
+		{`let a = [1 + 2, {3 - 1: ~0}];`, `let a = [3,{2:-1}];`},
+		{`if (1 > 2) { a } else { b }`, `b`},
+		{`if (x) { 1 + 1 }`, `if x 2`},
+		{`if (true) { let a = 1; a }; b`, `let a = 1;ab`},
+		{`if (false) { a }; b`, `b`},
+		{`let f = fn() { if (1 < 2) { 1; 2 } }`, `let f = fn<f>()12;`},
+		// the value of the program is null
+		{`if (0) { a }`, `if 0 a`},
+		{`if (true) { let a = 1; }`, `if true let a = 1;`},
+		// failing at run time
+		{`1 / 0`, `(1/0)`},
+		{`1 >> -1`, `(1>>-1)`},
+		{`"a" - "b"`, `(a-b)`},
+		// depending on the VM options
+		{`9223372036854775807 + 1`, `(9223372036854775807+1)`},
+		{`-(-9223372036854775807 - 1)`, `(--9223372036854775808)`},
+		{`1 << 64`, `(1<<64)`},
+		{`"a" < "b"`, `(a<b)`},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input)
+		folded := Fold(program)
+		if folded != program {
+			t.Errorf("%s: the program was not folded in place", tt.input)
+		}
+		if folded.String() != tt.expected {
+			t.Errorf("%s: wrong folding. want=%q got=%q", tt.input, tt.expected, folded.String())
+		}
+	}
+}
+
+func TestFoldCompile(t *testing.T) {
+	tests := []compilerTestCase{
+		{`2 * 60 * 60`, []any{7200}, []Instructions{
+			Make(OpConstant, 0),
+			Make(OpPop),
+		}},
+		{`if (true) { 10 } else { 20 }; 3333`, []any{10, 3333}, []Instructions{
+			Make(OpConstant, 0),
+			Make(OpPop),
+			Make(OpConstant, 1),
+			Make(OpPop),
+		}},
+		{`if (false) { 10 }; 1`, []any{1}, []Instructions{
+			Make(OpConstant, 0),
+			Make(OpPop),
+		}},
+		{`if (1 == 1) { let a = 1; a }`, []any{1}, []Instructions{
+			Make(OpConstant, 0),
+			Make(OpSetGlobal, 0),
+			Make(OpGetGlobal, 0),
+			Make(OpPop),
+		}},
+		{`10 % (2 - 2)`, []any{10, 0}, []Instructions{
+			Make(OpConstant, 0),
+			Make(OpConstant, 1),
+			Make(OpMod),
+			Make(OpPop),
+		}},
+	}
+	for _, tt := range tests {
+		compiler := New()
+		compiler.SetOptions(Options{Fold: true})
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compile error: %s", err)
+		}
+		bc := compiler.Bytecode()
+		if err := testConstants(t, tt.expectedConstants, bc.Constants); err != nil {
+			t.Errorf("%s: %s", tt.input, err)
+			continue
+		}
+		if err := testInstructions(t, tt.expectedInstructions, bc.Instructions); err != nil {
+			t.Errorf("%s: %s", tt.input, err)
+		}
+	}
+}
+
+func TestFoldVm(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`let h = 2 * 60 * 60; h / 3600`, 2},
+		{`"異" + "世界" == "異世界"`, true},
+		{`if (1 < 2) { if (false) { 1 } else { 2.5 * 2 } }`, 5.0},
+		{`let f = fn(x) { if (!true) { x } }; f(1)`, nil},
+		{`let f = fn(x) { if (true) { let y = x; } }; f(1)`, nil},
+		{`let f = fn(x) { if (true) { return x; }; 2 }; f(1)`, 1},
+		{`try { 1 / (1 - 1) } catch (e) { e["kind"] }`, string(interp.KindDivisionByZero)},
+		// hash pairs are evaluated in source order, folded keys or not
+		{`try { {(9-1): throw("x"), 5: throw("y")} } catch (e) { e["message"] }`, "x"},
+	}
+	for _, tt := range tests {
+		compiler := New()
+		compiler.SetOptions(Options{Fold: true})
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compile error: %s", err)
+		}
+		vm := NewVm(compiler.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("%s: vm error: %s", tt.input, err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPop())
+	}
+
+	compiler := New()
+	compiler.SetOptions(Options{Fold: true})
+	if err := compiler.Compile(parse(`1 + 2 * (3 / 0)`)); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	var rerr *RuntimeError
+	if err := NewVm(compiler.Bytecode()).Run(); !errors.As(err, &rerr) || rerr.Kind != interp.KindDivisionByZero {
+		t.Errorf("want a division by zero error. got=%v", err)
+	}
+}
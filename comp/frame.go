@@ -1,5 +1,7 @@
 package comp
 
+const mainName = "<main>"
+
 type Frame struct {
 	cl          *Closure
 	ip          int
@@ -10,6 +12,17 @@ func NewFrame(cl *Closure, basePointer int) *Frame {
 	return &Frame{cl, 0, basePointer}
 }
 
+// NewMainFrame returns the frame running the top-level instructions of b.
+func NewMainFrame(b *Bytecode) *Frame {
+	mainFn := &CompiledFunction{
+		Instructions: b.Instructions,
+		Name:         mainName,
+		File:         b.File,
+		SourceMap:    b.SourceMap,
+	}
+	return NewFrame(&Closure{Fn: mainFn}, 0)
+}
+
 func (f *Frame) Instructions() Instructions {
 	return f.cl.Fn.Instructions
 }
@@ -8,12 +8,25 @@ import (
 const (
 	CompiledFuncType interp.ObjectType = "COMPILED_FUNCTION_OBJ"
 	ClosureType      interp.ObjectType = "CLOSURE"
+	BoxType          interp.ObjectType = "BOX"
 )
 
 type CompiledFunction struct {
 	Instructions
 	NumLocals int
 	NumArgs   int
+	Name      string
+	File      string
+	SourceMap SourceMap
+}
+
+// Position returns the source position of the instruction at offset.
+func (c *CompiledFunction) Position(offset int) Position {
+	sp, ok := c.SourceMap.Lookup(offset)
+	if !ok {
+		return Position{File: c.File}
+	}
+	return Position{c.File, sp.Line, sp.Column}
 }
 
 func (c *CompiledFunction) Type() interp.ObjectType { return CompiledFuncType }
@@ -21,49 +34,23 @@ func (c *CompiledFunction) Inspect() string {
 	return fmt.Sprintf("Compiledfunction[%p]", c)
 }
 
-var Builtins = []struct {
-	pos  int
-	Name string
-	fn   *interp.Builtin
-}{
-	{
-		pos:  0,
-		Name: "len",
-		fn:   interp.Builtins["len"],
-	},
-	{
-		pos:  1,
-		Name: "first",
-		fn:   interp.Builtins["first"],
-	},
-	{
-		pos:  2,
-		Name: "last",
-		fn:   interp.Builtins["last"],
-	},
-	{
-		pos:  3,
-		Name: "rest",
-		fn:   interp.Builtins["rest"],
-	},
-	{
-		pos:  4,
-		Name: "push",
-		fn:   interp.Builtins["push"],
-	},
-	{
-		pos:  5,
-		Name: "puts",
-		fn:   interp.Builtins["puts"],
-	},
-}
-
 type Closure struct {
 	Fn   *CompiledFunction
-	Free []interp.Object
+	Free []*Box
 }
 
 func (c *Closure) Type() interp.ObjectType { return ClosureType }
 func (c *Closure) Inspect() string {
 	return fmt.Sprintf("Closure[%p]", c)
 }
+
+// Box holds a variable captured by closures, shared with its local slot so
+// all of them see assignments.
+type Box struct {
+	Value interp.Object
+}
+
+func (b *Box) Type() interp.ObjectType { return BoxType }
+func (b *Box) Inspect() string {
+	return fmt.Sprintf("Box[%s]", b.Value.Inspect())
+}
@@ -0,0 +1,48 @@
+package comp
+
+import (
+	"fmt"
+	"sort"
+)
+
+const defaultFile = "<input>"
+
+type Position struct {
+	File         string
+	Line, Column int
+}
+
+func (p Position) String() string {
+	file := p.File
+	if file == "" {
+		file = defaultFile
+	}
+	return fmt.Sprintf("%s:%d:%d", file, p.Line, p.Column)
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// SourcePos marks that the instructions starting at Offset are compiled
+// from the source at Line and Column.
+type SourcePos struct {
+	Offset       int
+	Line, Column int
+}
+
+// SourceMap is the side table of instruction offsets to source positions,
+// sorted by Offset.
+type SourceMap []SourcePos
+
+// Lookup returns the position of the instruction covering offset.
+func (s SourceMap) Lookup(offset int) (SourcePos, bool) {
+	i := sort.Search(len(s), func(i int) bool { return s[i].Offset > offset })
+	if i == 0 {
+		return SourcePos{}, false
+	}
+	return s[i-1], true
+}
+
+type positioned interface {
+	Line() int
+	Column() int
+}
@@ -1,5 +1,7 @@
 package comp
 
+import "maps"
+
 type SymbolScope string
 
 const (
@@ -19,6 +21,7 @@ type Symbol struct {
 type SymbolTable struct {
 	store       map[string]Symbol
 	numdef      int
+	blockStart  int
 	scoped      *SymbolTable
 	FreeSymbols []Symbol
 }
@@ -27,16 +30,52 @@ func NewSymbolTable() *SymbolTable {
 	return &SymbolTable{store: map[string]Symbol{}}
 }
 
+// Define binds sym in s. A name already defined in the current block keeps
+// its slot, so code compiled earlier, like a loop condition, sees it.
 func (s *SymbolTable) Define(sym string) Symbol {
 	syms := Symbol{sym, GlobalScope, s.numdef}
 	if s.scoped != nil {
 		syms.Scope = LocalScope
 	}
+	if prev, ok := s.store[sym]; ok && prev.Scope == syms.Scope && prev.Index >= s.blockStart {
+		return prev
+	}
 	s.numdef++
 	s.store[sym] = syms
 	return syms
 }
 
+// EnterBlock starts a block whose definitions shadow the outer ones until
+// the returned function ends it.
+func (s *SymbolTable) EnterBlock() (leave func()) {
+	outer := maps.Clone(s.store)
+	start := s.blockStart
+	s.blockStart = s.numdef
+	return func() {
+		for name, sym := range s.store {
+			if (sym.Scope == GlobalScope || sym.Scope == LocalScope) && sym.Index >= s.blockStart {
+				if prev, ok := outer[name]; ok {
+					s.store[name] = prev
+				} else {
+					delete(s.store, name)
+				}
+			}
+		}
+		s.blockStart = start
+	}
+}
+
+// snapshot returns the function restoring the definitions of s to the
+// current ones.
+func (s *SymbolTable) snapshot() (restore func()) {
+	store, numdef, blockStart, numFree := maps.Clone(s.store), s.numdef, s.blockStart, len(s.FreeSymbols)
+	return func() {
+		s.store = maps.Clone(store)
+		s.numdef, s.blockStart = numdef, blockStart
+		s.FreeSymbols = s.FreeSymbols[:numFree]
+	}
+}
+
 func (s *SymbolTable) DefineBuiltin(index int, sym string) Symbol {
 	ss := Symbol{sym, BuiltinScope, index}
 	s.store[sym] = ss
@@ -65,9 +104,9 @@ func (s *SymbolTable) Resolve(sym string) (Symbol, bool) {
 			return ss, ok
 		}
 		s.FreeSymbols = append(s.FreeSymbols, ss)
-		s.store[sym] = ss
 		ss.Scope = FreeScope
 		ss.Index = len(s.FreeSymbols) - 1
+		s.store[sym] = ss
 	}
 	return ss, ok
 }
@@ -166,6 +166,60 @@ func TestResolveFree(t *testing.T) {
 	}
 }
 
+func TestResolveFree_twice(t *testing.T) {
+	glob := NewSymbolTable()
+	local := NewFrameSymbolTable(glob)
+	local.Define("a")
+	local.Define("b")
+	inner := NewFrameSymbolTable(local)
+
+	for range 2 {
+		r, ok := inner.Resolve("b")
+		if !ok {
+			t.Fatalf("name b is not resolvable")
+		}
+		if exp := (Symbol{"b", FreeScope, 0}); r != exp {
+			t.Errorf("expected b to resolve to %+v, got=%+v", exp, r)
+		}
+	}
+	if len(inner.FreeSymbols) != 1 {
+		t.Errorf("wrong number of free symbols. got=%d want=1", len(inner.FreeSymbols))
+	}
+}
+
+func TestEnterBlock(t *testing.T) {
+	glob := NewSymbolTable()
+	glob.Define("a")
+	local := NewFrameSymbolTable(glob)
+	local.Define("b")
+
+	leave := local.EnterBlock()
+	expected := []Symbol{
+		{"b", LocalScope, 1},
+		{"c", LocalScope, 2},
+		{"b", LocalScope, 1},
+	}
+	for i, name := range []string{"b", "c", "b"} {
+		if r := local.Define(name); r != expected[i] {
+			t.Errorf("expected %s to be defined as %+v, got=%+v", name, expected[i], r)
+		}
+	}
+	if r, _ := local.Resolve("a"); r != (Symbol{"a", GlobalScope, 0}) {
+		t.Errorf("wrong symbol for a in the block. got=%+v", r)
+	}
+	leave()
+
+	if r, _ := local.Resolve("b"); r != (Symbol{"b", LocalScope, 0}) {
+		t.Errorf("expected b to be restored. got=%+v", r)
+	}
+	if r, ok := local.Resolve("c"); ok {
+		t.Errorf("expected c to be undefined after the block. got=%+v", r)
+	}
+	if r := local.Define("d"); r != (Symbol{"d", LocalScope, 3}) {
+		t.Errorf("expected d to take a new slot. got=%+v", r)
+	}
+}
+
 func TestResolve_unresolvableFree(t *testing.T) {
 	isekai := "異世界"
 	lsekai := "isekai"
@@ -2,18 +2,25 @@ package comp
 
 import (
 	"compgo/interp"
-	"encoding/binary"
+	"context"
 	"errors"
 	"fmt"
-	"path"
-	"runtime"
+	"math"
+	"math/big"
 	"unicode/utf8"
 )
 
 const (
-	stackSize  = 2048
-	GlobalSize = 65536
-	MaxFrames  = 1024
+	stackSize    = 2048
+	GlobalSize   = 65536
+	MaxFrames    = 1024
+	MaxStackSize = 65536
+
+	// MaxLocals, MaxArgs and MaxFree bound the operands of OpGetLocal,
+	// OpCall and OpClosure, which OpWide widens to 2 bytes.
+	MaxLocals = 1 << 16
+	MaxArgs   = 1<<16 - 1
+	MaxFree   = 1<<16 - 1
 )
 
 type Vm struct {
@@ -24,6 +31,28 @@ type Vm struct {
 	globals  []interp.Object
 	frames   []*Frame
 	frameIdx int
+	op       Opcode
+	// wide is set while running an instruction prefixed by OpWide.
+	wide     bool
+	handlers []handler
+	builtins *Registry
+	collate  bool
+	bigInt   bool
+
+	maxFrames       int
+	maxStack        int
+	maxInstructions int
+	executed        int
+	ctx             context.Context
+	done            <-chan struct{}
+}
+
+// handler is the catch block installed by OpTry. When an error happens
+// the frames and the stack are unwound back to where the try started.
+type handler struct {
+	frameIdx int
+	stackLen int
+	catchIP  int
 }
 
 func NewVm(b *Bytecode) *Vm {
@@ -32,12 +61,15 @@ func NewVm(b *Bytecode) *Vm {
 		Stack:     make(Stack[interp.Object], 0, stackSize),
 		sp:        0,
 		globals:   make([]interp.Object, GlobalSize),
-		frames:    make([]*Frame, MaxFrames),
+		frames:    make([]*Frame, 1, MaxFrames),
+		maxFrames: MaxFrames,
+		maxStack:  MaxStackSize,
+	}
+	vm.builtins = b.Builtins
+	if vm.builtins == nil {
+		vm.builtins = NewRegistry()
 	}
-	mainFn := &CompiledFunction{Instructions: b.Instructions}
-	mainClosure := &Closure{Fn: mainFn}
-	frame := NewFrame(mainClosure, 0)
-	vm.frames[0] = frame
+	vm.frames[0] = NewMainFrame(b)
 	vm.frameIdx = 1
 	return vm
 }
@@ -50,6 +82,42 @@ func (vm *Vm) SetGlobals(globs []interp.Object) {
 	vm.globals = globs
 }
 
+// SetBuiltins sets the registry OpGetBuiltin reads from. It must be the
+// one the bytecode was compiled against.
+func (vm *Vm) SetBuiltins(r *Registry) {
+	vm.builtins = r
+}
+
+// SetCollate makes the ordering operators compare strings with
+// interp.Collate instead of by code point.
+func (vm *Vm) SetCollate(on bool) {
+	vm.collate = on
+}
+
+// SetBigInt makes integer arithmetic overflowing an int give an
+// interp.BigInteger instead of wrapping around.
+func (vm *Vm) SetBigInt(on bool) {
+	vm.bigInt = on
+}
+
+// SetMaxFrames sets how deep function calls may nest, MaxFrames by
+// default. Calling past it fails with a KindStackOverflow error.
+func (vm *Vm) SetMaxFrames(n int) {
+	vm.maxFrames = n
+}
+
+// SetMaxStack sets how many values the stack may hold, MaxStackSize by
+// default. Growing the stack past it fails with a KindStackOverflow error.
+func (vm *Vm) SetMaxStack(n int) {
+	vm.maxStack = n
+}
+
+// SetMaxInstructions limits how many instructions a single run may
+// execute. Zero, the default, means no limit.
+func (vm *Vm) SetMaxInstructions(n int) {
+	vm.maxInstructions = n
+}
+
 func (vm *Vm) StackTop() interp.Object {
 	if len(vm.Stack) == 0 {
 		return nil
@@ -61,14 +129,32 @@ func (vm *Vm) currentFrame() *Frame {
 	return vm.frames[vm.frameIdx-1]
 }
 
-func (vm *Vm) pushFrame(f *Frame) {
-	vm.frames[vm.frameIdx] = f
+func (vm *Vm) pushFrame(f *Frame) error {
+	if vm.frameIdx >= vm.maxFrames {
+		return newRuntimeError(interp.KindStackOverflow,
+			fmt.Sprintf("stack overflow: maximum call depth %d exceeded", vm.maxFrames))
+	}
+	if vm.frameIdx == len(vm.frames) {
+		vm.frames = append(vm.frames, f)
+	} else {
+		vm.frames[vm.frameIdx] = f
+	}
 	vm.frameIdx++
+	return nil
+}
+
+func (vm *Vm) stackOverflow() error {
+	return newRuntimeError(interp.KindStackOverflow,
+		fmt.Sprintf("stack overflow: stack size %d exceeded", vm.maxStack))
 }
 
 func (vm *Vm) popFrame() *Frame {
 	vm.frameIdx--
 	f := vm.frames[vm.frameIdx]
+	// try blocks left by returning from the function
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].frameIdx > vm.frameIdx {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
 	return f
 }
 
@@ -90,7 +176,8 @@ func (vm *Vm) LastPop() interp.Object {
 }
 
 var (
-	ErrEmptyStack = fmt.Errorf("empty stack")
+	ErrEmptyStack       = fmt.Errorf("empty stack")
+	ErrInstructionLimit = errors.New("instruction limit exceeded")
 )
 
 type Stack[T any] []T
@@ -118,35 +205,113 @@ func (s *Stack[T]) Pop() (T, error) {
 	return val, nil
 }
 
+// Run executes the current frame until its instructions are exhausted.
+// Uncaught errors, Go panics included, are returned as *RuntimeError.
 func (vm *Vm) Run() error {
-	inspectEmptyStack := func(err error) {
-		pc, file, lineno, _ := runtime.Caller(1)
-		funcname := runtime.FuncForPC(pc).Name()
-		fname := path.Base(file)
-		if errors.Is(err, ErrEmptyStack) {
-			fmt.Printf("%s#%s:%d inst:\n%s\n",
-				fname, funcname, lineno, vm.currentFrame().cl.Fn.Instructions)
+	return vm.RunContext(context.Background())
+}
+
+// RunContext is Run that stops with an uncatchable KindCancelled error
+// once ctx is done, checked at backward jumps and calls.
+func (vm *Vm) RunContext(ctx context.Context) (err error) {
+	vm.ctx, vm.done = ctx, ctx.Done()
+	vm.executed = 0
+	defer func() {
+		if r := recover(); r != nil {
+			err = vm.runtimeError(fmt.Errorf("internal error: %v", r))
+		}
+	}()
+	for {
+		err := vm.run()
+		if err == nil {
+			return nil
+		}
+		rerr := vm.runtimeError(err)
+		if !rerr.Kind.Catchable() || !vm.catch(rerr) {
+			return rerr
+		}
+	}
+}
+
+// Call calls fn, a closure or a builtin, with args using the constants,
+// globals and builtins of the VM, and returns the result.
+func (vm *Vm) Call(fn interp.Object, args ...interp.Object) (interp.Object, error) {
+	if len(args) > MaxArgs {
+		return nil, fmt.Errorf("too many arguments: %d", len(args))
+	}
+	main := &CompiledFunction{Instructions: Make(OpCall, len(args)), Name: mainName}
+	vm.frames[0] = NewFrame(&Closure{Fn: main}, 0)
+	vm.frameIdx = 1
+	vm.handlers = nil
+	vm.Stack = vm.Stack[:0]
+	vm.Push(fn)
+	for _, arg := range args {
+		vm.Push(arg)
+	}
+	if err := vm.Run(); err != nil {
+		return nil, err
+	}
+	return vm.Pop()
+}
+
+// checkBudget is called where a run can loop: backward jumps and calls.
+func (vm *Vm) checkBudget() error {
+	if vm.maxInstructions > 0 && vm.executed > vm.maxInstructions {
+		return &RuntimeError{Kind: interp.KindBudgetExceeded, Err: ErrInstructionLimit}
+	}
+	if vm.done != nil {
+		select {
+		case <-vm.done:
+			return &RuntimeError{Kind: interp.KindCancelled, Err: vm.ctx.Err()}
+		default:
 		}
 	}
+	return nil
+}
+
+// catch unwinds to the innermost handler and continues at its catch block
+// with the error hash on top of the stack.
+func (vm *Vm) catch(rerr *RuntimeError) bool {
+	if len(vm.handlers) == 0 {
+		return false
+	}
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.frameIdx = h.frameIdx
+	vm.Stack = vm.Stack[:h.stackLen]
+	vm.Push(rerr.Object().ToHash())
+	vm.currentFrame().ip = h.catchIP
+	return true
+}
+
+func (vm *Vm) run() error {
 	for vm.currentFrame().ip < len(vm.currentFrame().Instructions()) {
+		if len(vm.Stack) > vm.maxStack {
+			return vm.stackOverflow()
+		}
 		ins := vm.currentFrame().Instructions()
 		op := Opcode(ins[vm.currentFrame().ip])
 		vm.currentFrame().ip++
+		vm.wide = op == OpWide
+		if vm.wide {
+			op = Opcode(ins[vm.currentFrame().ip])
+			vm.currentFrame().ip++
+		}
+		vm.op = op
+		vm.executed++
 		switch op {
 		case OpConstant:
-			ip := vm.currentFrame().ip
-			width := 2
-			idx := binary.BigEndian.Uint16(ins[ip:])
+			idx := vm.operand(2)
 			vm.Stack.Push(vm.constants[idx])
-			vm.currentFrame().ip += width
 		case OpAdd, OpSub, OpMul, OpDiv, OpEq, OpNeq,
-			OpLt, OpLte, OpGt, OpGte:
+			OpLt, OpLte, OpGt, OpGte,
+			OpMod, OpPow, OpBitAnd, OpBitOr, OpBitXor, OpShl, OpShr:
 			fn, ok := mapInfixOps[op]
 			if !ok {
-				return fmt.Errorf("undefined infix operator: %d", op)
+				return newRuntimeError(interp.KindInternal,
+					fmt.Sprintf("undefined infix operator: %d", op))
 			}
 			if err := fn(vm); err != nil {
-				inspectEmptyStack(err)
 				return err
 			}
 		case OpPop:
@@ -158,68 +323,97 @@ func (vm *Vm) Run() error {
 		case OpMinus:
 			lastval, err := vm.Pop()
 			if err != nil {
-				inspectEmptyStack(err)
 				return err
 			}
-			i, ok := lastval.(*interp.Integer)
-			if !ok {
-				return fmt.Errorf("wrong type not integer. got=%T (%+v)",
-					lastval, lastval)
+			switch n := lastval.(type) {
+			case *interp.Integer:
+				if vm.bigInt && n.Value == math.MinInt {
+					vm.Push(interp.BigIntPrefix("-", big.NewInt(int64(n.Value))))
+					break
+				}
+				vm.Push(&interp.Integer{Primitive: interp.Primitive[int]{Value: -n.Value}})
+			case *interp.BigInteger:
+				vm.Push(interp.BigIntPrefix("-", n.Value))
+			case *interp.Float:
+				vm.Push(&interp.Float{Primitive: interp.Primitive[float64]{Value: -n.Value}})
+			default:
+				return newRuntimeError(interp.KindTypeMismatch,
+					fmt.Sprintf("unknown operator: -%s", lastval.Type()), lastval)
+			}
+		case OpBitNot:
+			lastval, err := vm.Pop()
+			if err != nil {
+				return err
+			}
+			switch n := lastval.(type) {
+			case *interp.Integer:
+				vm.Push(&interp.Integer{Primitive: interp.Primitive[int]{Value: ^n.Value}})
+			case *interp.BigInteger:
+				vm.Push(interp.BigIntPrefix("~", n.Value))
+			default:
+				return newRuntimeError(interp.KindTypeMismatch,
+					fmt.Sprintf("unknown operator: ~%s", lastval.Type()), lastval)
 			}
-			i.Value *= -1
-			vm.Push(i)
 		case OpBang:
 			lastitem, err := vm.Pop()
 			if err != nil {
-				inspectEmptyStack(err)
 				return err
 			}
 			if err := notObj(vm, lastitem); err != nil {
-				inspectEmptyStack(err)
 				return err
 			}
 		case OpJump:
-			addr := binary.BigEndian.Uint16(ins[vm.currentFrame().ip:])
-			vm.currentFrame().ip = int(addr)
+			addr := vm.operand(2)
+			if addr < vm.currentFrame().ip {
+				if err := vm.checkBudget(); err != nil {
+					return err
+				}
+			}
+			vm.currentFrame().ip = addr
 		case OpJumpIfFalsy:
-			addr := binary.BigEndian.Uint16(ins[vm.currentFrame().ip:])
-			vm.currentFrame().ip += 2
+			addr := vm.operand(2)
 			cond, err := vm.Pop()
 			if err != nil {
-				inspectEmptyStack(err)
 				return err
 			}
-			if !isTruthy(cond) {
-				vm.currentFrame().ip = int(addr)
+			if !interp.IsTruthy(cond) {
+				vm.currentFrame().ip = addr
+			}
+		case OpJumpIfTruthy:
+			addr := vm.operand(2)
+			cond, err := vm.Pop()
+			if err != nil {
+				return err
+			}
+			if interp.IsTruthy(cond) {
+				vm.currentFrame().ip = addr
 			}
 		case OpNull:
 			vm.Push(interp.NullObject)
 		case OpSetGlobal:
-			idx := binary.BigEndian.Uint16(ins[vm.currentFrame().ip:])
-			vm.currentFrame().ip += 2
+			idx := vm.operand(2)
 			glb, err := vm.Pop()
 			if err != nil {
-				inspectEmptyStack(err)
 				return err
 			}
 			vm.globals[idx] = glb
 		case OpGetGlobal:
-			idx := binary.BigEndian.Uint16(ins[vm.currentFrame().ip:])
-			vm.currentFrame().ip += 2
+			idx := vm.operand(2)
 			glb := vm.globals[idx]
+			if glb == nil {
+				return newRuntimeError(interp.KindUndefined, "identifier not found: global not set")
+			}
 			vm.Push(glb)
 		case OpArray:
-			elm := binary.BigEndian.Uint16(ins[vm.currentFrame().ip:])
-			vm.currentFrame().ip += 2
-			vm.sp = len(vm.Stack) - int(elm)
+			elm := vm.operand(2)
+			vm.sp = len(vm.Stack) - elm
 			arr := &interp.SliceObj{Elements: make([]interp.Object, elm)}
 			copy(arr.Elements, vm.Stack[vm.sp:])
 			vm.Stack = vm.Stack[:vm.sp]
 			vm.Push(arr)
 		case OpHash:
-			pairs := binary.BigEndian.Uint16(ins[vm.currentFrame().ip:])
-			vm.currentFrame().ip += 2
-			vm.sp = len(vm.Stack) - int(pairs)
+			pairs := vm.operand(2)
+			vm.sp = len(vm.Stack) - pairs
 			h := &interp.Hash{Pairs: map[interp.HashKey]interp.HashPair{}}
 			for i := vm.sp; i < len(vm.Stack); i += 2 {
 				k := vm.Stack[i]
@@ -227,31 +421,38 @@ func (vm *Vm) Run() error {
 				pair := interp.HashPair{Key: k, Value: v}
 				hk, ok := k.(interp.Hashable)
 				if !ok {
-					return fmt.Errorf("unusable as hash key: %s", k.Type())
+					return newRuntimeError(interp.KindUnhashableKey,
+						fmt.Sprintf("unusable as hash key: %s", k.Type()), k)
 				}
 				h.Pairs[hk.HashKey()] = pair
 			}
+			vm.Stack = vm.Stack[:vm.sp]
 			vm.Push(h)
 		case OpIndex:
 			if err := processIndex(vm); err != nil {
-				inspectEmptyStack(err)
 				return err
 			}
 		case OpCall:
-			arity := ins[vm.currentFrame().ip]
-			vm.currentFrame().ip++
-			switch fn := vm.Stack[len(vm.Stack)-int(arity)-1].(type) {
+			arity := vm.operand(1)
+			if len(vm.Stack) < arity+1 {
+				return ErrEmptyStack
+			}
+			if err := vm.checkBudget(); err != nil {
+				return err
+			}
+			switch fn := vm.Stack[len(vm.Stack)-arity-1].(type) {
 			// case *CompiledFunction:
 			case *Closure:
-				if err := callFunction(vm, fn, int(arity)); err != nil {
+				if err := callFunction(vm, fn, arity); err != nil {
 					return err
 				}
 			case *interp.Builtin:
-				if err := callBuiltin(vm, fn, int(arity)); err != nil {
+				if err := callBuiltin(vm, fn, arity); err != nil {
 					return err
 				}
 			default:
-				return fmt.Errorf("calling non-function nor builtin-function")
+				return newRuntimeError(interp.KindTypeMismatch,
+					fmt.Sprintf("not a function: %s", fn.Type()), fn)
 			}
 		case OpReturnValue:
 			retval, err := vm.Pop()
@@ -259,71 +460,111 @@ func (vm *Vm) Run() error {
 				return err
 			}
 			frame := vm.popFrame()
-			for range frame.cl.Fn.NumLocals {
-				vm.Pop()
-			}
-			vm.Pop()
+			// drops the locals and the function called
+			vm.Stack = vm.Stack[:frame.basePointer-1]
 			vm.Push(retval)
 		case OpReturn:
 			frame := vm.popFrame()
-			for range frame.cl.Fn.NumLocals {
-				vm.Pop()
-			}
-			vm.Pop()
+			vm.Stack = vm.Stack[:frame.basePointer-1]
 			vm.Push(interp.NullObject)
 		case OpSetLocal:
-			idx := ins[vm.currentFrame().ip]
-			vm.currentFrame().ip++
-			frame := vm.currentFrame()
-			offset := frame.basePointer + int(idx)
-			if offset >= len(vm.Stack)-1 {
-				continue
-			}
+			idx := vm.operand(1)
+			offset := vm.currentFrame().basePointer + idx
 			obj, err := vm.Pop()
 			if err != nil {
 				return err
 			}
-			vm.Stack[frame.basePointer+int(idx)] = obj
+			if box, ok := vm.Stack[offset].(*Box); ok {
+				box.Value = obj
+				continue
+			}
+			vm.Stack[offset] = obj
 		case OpGetLocal:
-			idx := ins[vm.currentFrame().ip]
-			vm.currentFrame().ip++
+			idx := vm.operand(1)
 			frame := vm.currentFrame()
-			vm.Push(vm.Stack[frame.basePointer+int(idx)])
+			obj := vm.Stack[frame.basePointer+idx]
+			if box, ok := obj.(*Box); ok {
+				obj = box.Value
+			}
+			vm.Push(obj)
+		case OpBoxLocal:
+			idx := vm.operand(1)
+			offset := vm.currentFrame().basePointer + idx
+			box, ok := vm.Stack[offset].(*Box)
+			if !ok {
+				box = &Box{vm.Stack[offset]}
+				vm.Stack[offset] = box
+			}
+			vm.Push(box)
 		case OpGetBuiltin:
-			builtIdx := int(ins[vm.currentFrame().ip])
-			vm.currentFrame().ip++
-			builtin := Builtins[builtIdx]
-			vm.Push(builtin.fn)
+			builtIdx := vm.operand(1)
+			builtin := vm.builtins.Builtin(builtIdx)
+			if builtin == nil {
+				return newRuntimeError(interp.KindUndefined,
+					fmt.Sprintf("undefined builtin: %d", builtIdx))
+			}
+			vm.Push(builtin)
 		case OpClosure:
-			idx := int(binary.BigEndian.Uint16(ins[vm.currentFrame().ip:]))
-			vm.currentFrame().ip += 2
-			freebind := int(ins[vm.currentFrame().ip])
-			vm.currentFrame().ip++
+			idx := vm.operand(2)
+			freebind := vm.operand(1)
 			cnst := vm.constants[idx]
 			fn, ok := cnst.(*CompiledFunction)
 			if !ok {
-				return fmt.Errorf("not a function: %+v, %T", cnst, cnst)
+				return newRuntimeError(interp.KindInternal,
+					fmt.Sprintf("closure constant is not a function: %s", cnst.Type()), cnst)
 			}
-			frees := make([]interp.Object, freebind)
+			frees := make([]*Box, freebind)
 			for i := range freebind {
-				frees[i] = vm.Stack[len(vm.Stack)-freebind+i]
+				obj := vm.Stack[len(vm.Stack)-freebind+i]
+				box, ok := obj.(*Box)
+				if !ok {
+					// the closure itself, which is never assigned
+					box = &Box{obj}
+				}
+				frees[i] = box
 			}
 			vm.Stack = vm.Stack[:len(vm.Stack)-freebind]
 			closure := &Closure{Fn: fn, Free: frees}
 			vm.Push(closure)
 		case OpGetFree:
-			idx := int(ins[vm.currentFrame().ip])
-			vm.currentFrame().ip++
+			idx := vm.operand(1)
 			cl := vm.currentFrame().cl
-			vm.Push(cl.Free[idx])
+			vm.Push(cl.Free[idx].Value)
+		case OpSetFree:
+			idx := vm.operand(1)
+			obj, err := vm.Pop()
+			if err != nil {
+				return err
+			}
+			vm.currentFrame().cl.Free[idx].Value = obj
+		case OpBoxFree:
+			idx := vm.operand(1)
+			vm.Push(vm.currentFrame().cl.Free[idx])
 		case OpCurrentClosure:
 			ccl := vm.currentFrame().cl
 			vm.Push(ccl)
+		case OpTry:
+			addr := vm.operand(2)
+			vm.handlers = append(vm.handlers, handler{vm.frameIdx, len(vm.Stack), addr})
+		case OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
 		}
 	}
 	return nil
 }
 
+// operand reads the next operand of the current instruction, width bytes
+// wide or twice that after OpWide.
+func (vm *Vm) operand(width int) int {
+	frame := vm.currentFrame()
+	if vm.wide {
+		width *= 2
+	}
+	opr := ReadOperand(frame.Instructions()[frame.ip:], width)
+	frame.ip += width
+	return opr
+}
+
 func (vm *Vm) pop2() (interp.Object, interp.Object, error) {
 	right, err := vm.Pop()
 	if err != nil {
@@ -336,33 +577,91 @@ func (vm *Vm) pop2() (interp.Object, interp.Object, error) {
 	return left, right, nil
 }
 
+var opSymbols = map[Opcode]string{
+	OpAdd:    "+",
+	OpSub:    "-",
+	OpMul:    "*",
+	OpDiv:    "/",
+	OpGt:     ">",
+	OpLt:     "<",
+	OpGte:    ">=",
+	OpLte:    "<=",
+	OpMod:    "%",
+	OpPow:    "**",
+	OpBitAnd: "&",
+	OpBitOr:  "|",
+	OpBitXor: "^",
+	OpShl:    "<<",
+	OpShr:    ">>",
+}
+
 var mapInfixOps = map[Opcode]func(vm *Vm) error{
-	OpAdd: add,
-	OpSub: sub,
-	OpMul: mul,
-	OpDiv: div,
-	OpEq:  eqObj,
-	OpNeq: neqObj,
-	OpGt:  gtObj,
-	OpLt:  ltObj,
-	OpGte: gteObj,
-	OpLte: lteObj,
-}
-
-func arith(vm *Vm, fop func(vm *Vm, left, right *interp.Integer)) error {
+	OpAdd:    add,
+	OpSub:    sub,
+	OpMul:    mul,
+	OpDiv:    div,
+	OpEq:     eqObj,
+	OpNeq:    neqObj,
+	OpGt:     gtObj,
+	OpLt:     ltObj,
+	OpGte:    gteObj,
+	OpLte:    lteObj,
+	OpMod:    mod,
+	OpPow:    pow,
+	OpBitAnd: bitwise(func(l, r int) int { return l & r }),
+	OpBitOr:  bitwise(func(l, r int) int { return l | r }),
+	OpBitXor: bitwise(func(l, r int) int { return l ^ r }),
+	OpShl:    shift,
+	OpShr:    shift,
+}
+
+func arith(vm *Vm, fop func(vm *Vm, left, right *interp.Integer) error) error {
+	return floatArith(vm, fop, nil)
+}
+
+// floatArith is arith calling flop instead of fop when one operand at least
+// is a float, the other being promoted. flop returns the float pushed.
+func floatArith(vm *Vm, fop func(vm *Vm, left, right *interp.Integer) error,
+	flop func(left, right float64) (float64, error)) error {
 	lobj, robj, err := vm.pop2()
 	if err != nil {
 		return err
 	}
-	lint, ok := lobj.(*interp.Integer)
-	if !ok {
-		return fmt.Errorf("object is not integer. got=%T (%+v)", lobj, lobj)
+	if l, r, ok := interp.FloatOperands(lobj, robj); ok && flop != nil {
+		f, err := flop(l, r)
+		if err != nil {
+			return err
+		}
+		vm.Push(&interp.Float{Primitive: interp.Primitive[float64]{Value: f}})
+		return nil
 	}
-	rint, ok := robj.(*interp.Integer)
-	if !ok {
-		return fmt.Errorf("object is not integer. got=%T (%+v)", robj, robj)
+	if l, r, ok := interp.IntOperands(lobj, robj); ok {
+		return pushBig(vm, interp.BigIntMath(opSymbols[vm.op], l, r), lobj, robj)
+	}
+	lint, lok := lobj.(*interp.Integer)
+	rint, rok := robj.(*interp.Integer)
+	if !lok || !rok {
+		return newRuntimeError(interp.KindTypeMismatch,
+			fmt.Sprintf("unknown operator: %s %s %s", lobj.Type(), opSymbols[vm.op], robj.Type()),
+			lobj, robj)
+	}
+	if vm.bigInt && interp.Overflows(opSymbols[vm.op], lint.Value, rint.Value) {
+		return pushBig(vm, bigIntMath(opSymbols[vm.op], lint, rint), lobj, robj)
 	}
-	fop(vm, lint, rint)
+	return fop(vm, lint, rint)
+}
+
+func bigIntMath(op string, left, right *interp.Integer) interp.Object {
+	return interp.BigIntMath(op, big.NewInt(int64(left.Value)), big.NewInt(int64(right.Value)))
+}
+
+// pushBig pushes the result of interp.BigIntMath, raising it instead when
+// it is an error.
+func pushBig(vm *Vm, res interp.Object, operands ...interp.Object) error {
+	if err, ok := res.(*interp.Error); ok {
+		return newRuntimeError(err.Kind, err.Msg, operands...)
+	}
+	vm.Push(res)
 	return nil
 }
 
@@ -371,11 +670,25 @@ func add(vm *Vm) error {
 	if err != nil {
 		return err
 	}
+	mismatch := func() error {
+		return newRuntimeError(interp.KindTypeMismatch,
+			fmt.Sprintf("unknown operator: %s + %s", lobj.Type(), robj.Type()), lobj, robj)
+	}
+	if l, r, ok := interp.FloatOperands(lobj, robj); ok {
+		vm.Push(&interp.Float{Primitive: interp.Primitive[float64]{Value: l + r}})
+		return nil
+	}
+	if l, r, ok := interp.IntOperands(lobj, robj); ok {
+		return pushBig(vm, interp.BigIntMath("+", l, r), lobj, robj)
+	}
 	switch rint := robj.(type) {
 	case *interp.Integer:
 		lint, ok := lobj.(*interp.Integer)
 		if !ok {
-			return fmt.Errorf("unknown operator: %s + %s", lobj.Type(), robj.Type())
+			return mismatch()
+		}
+		if vm.bigInt && interp.Overflows("+", lint.Value, rint.Value) {
+			return pushBig(vm, bigIntMath("+", lint, rint), lobj, robj)
 		}
 		newv := &interp.Integer{Primitive: interp.Primitive[int]{
 			Value: lint.Value + rint.Value,
@@ -384,7 +697,7 @@ func add(vm *Vm) error {
 	case *interp.String:
 		lstr, ok := lobj.(*interp.String)
 		if !ok {
-			return fmt.Errorf("unknown operator: %s + %s", lobj.Type(), robj.Type())
+			return mismatch()
 		}
 		newv := &interp.String{Primitive: interp.Primitive[string]{
 			Value: lstr.Value + rint.Value,
@@ -393,168 +706,199 @@ func add(vm *Vm) error {
 	case *interp.SliceObj:
 		larr, ok := lobj.(*interp.SliceObj)
 		if !ok {
-			return fmt.Errorf("unknown operator: %s + %s", larr.Type(), robj.Type())
+			return mismatch()
 		}
 		newarr := &interp.SliceObj{Elements: []interp.Object{}}
 		newarr.Elements = append(newarr.Elements, larr.Elements...)
 		newarr.Elements = append(newarr.Elements, rint.Elements...)
 		vm.Push(newarr)
 	default:
-		return fmt.Errorf("unknown operator: %s + %s", lobj.Type(), robj.Type())
+		return mismatch()
 	}
 	return nil
 }
 
 func sub(vm *Vm) error {
-	return arith(vm, func(vm *Vm, left, right *interp.Integer) {
+	return floatArith(vm, func(vm *Vm, left, right *interp.Integer) error {
 		newv := &interp.Integer{Primitive: interp.Primitive[int]{
 			Value: left.Value - right.Value,
 		}}
 		vm.Push(newv)
+		return nil
+	}, func(left, right float64) (float64, error) {
+		return left - right, nil
 	})
 }
 
 func mul(vm *Vm) error {
-	return arith(vm, func(vm *Vm, left, right *interp.Integer) {
+	return floatArith(vm, func(vm *Vm, left, right *interp.Integer) error {
 		newv := &interp.Integer{Primitive: interp.Primitive[int]{
 			Value: left.Value * right.Value,
 		}}
 		vm.Push(newv)
+		return nil
+	}, func(left, right float64) (float64, error) {
+		return left * right, nil
 	})
 }
 
+// floatDivisionByZero is the error of dividing the float left by the zero
+// right with op.
+func floatDivisionByZero(left, right float64, op string) error {
+	l := &interp.Float{Primitive: interp.Primitive[float64]{Value: left}}
+	r := &interp.Float{Primitive: interp.Primitive[float64]{Value: right}}
+	return newRuntimeError(interp.KindDivisionByZero,
+		fmt.Sprintf("division by zero: %s %s %s", l.Inspect(), op, r.Inspect()), l, r)
+}
+
 func div(vm *Vm) error {
-	return arith(vm, func(vm *Vm, left, right *interp.Integer) {
+	return floatArith(vm, func(vm *Vm, left, right *interp.Integer) error {
+		if right.Value == 0 {
+			return newRuntimeError(interp.KindDivisionByZero,
+				fmt.Sprintf("division by zero: %d / 0", left.Value), left, right)
+		}
 		newv := &interp.Integer{Primitive: interp.Primitive[int]{
 			Value: left.Value / right.Value,
 		}}
 		vm.Push(newv)
+		return nil
+	}, func(left, right float64) (float64, error) {
+		if right == 0 {
+			return 0, floatDivisionByZero(left, right, "/")
+		}
+		return left / right, nil
+	})
+}
+
+func mod(vm *Vm) error {
+	return floatArith(vm, func(vm *Vm, left, right *interp.Integer) error {
+		if right.Value == 0 {
+			return newRuntimeError(interp.KindDivisionByZero,
+				fmt.Sprintf("division by zero: %d %% 0", left.Value), left, right)
+		}
+		newv := &interp.Integer{Primitive: interp.Primitive[int]{
+			Value: left.Value % right.Value,
+		}}
+		vm.Push(newv)
+		return nil
+	}, func(left, right float64) (float64, error) {
+		if right == 0 {
+			return 0, floatDivisionByZero(left, right, "%")
+		}
+		return math.Mod(left, right), nil
 	})
 }
 
+func pow(vm *Vm) error {
+	return floatArith(vm, func(vm *Vm, left, right *interp.Integer) error {
+		if right.Value < 0 {
+			return newRuntimeError(interp.KindInvalidOperand,
+				fmt.Sprintf("negative exponent: %d ** %d", left.Value, right.Value), left, right)
+		}
+		newv := &interp.Integer{Primitive: interp.Primitive[int]{
+			Value: interp.IntPow(left.Value, right.Value),
+		}}
+		vm.Push(newv)
+		return nil
+	}, func(left, right float64) (float64, error) {
+		return math.Pow(left, right), nil
+	})
+}
+
+func bitwise(fop func(l, r int) int) func(vm *Vm) error {
+	return func(vm *Vm) error {
+		return arith(vm, func(vm *Vm, left, right *interp.Integer) error {
+			newv := &interp.Integer{Primitive: interp.Primitive[int]{
+				Value: fop(left.Value, right.Value),
+			}}
+			vm.Push(newv)
+			return nil
+		})
+	}
+}
+
+func shift(vm *Vm) error {
+	return arith(vm, func(vm *Vm, left, right *interp.Integer) error {
+		if right.Value < 0 {
+			return newRuntimeError(interp.KindInvalidOperand,
+				fmt.Sprintf("negative shift count: %d %s %d", left.Value, opSymbols[vm.op], right.Value),
+				left, right)
+		}
+		v := left.Value >> right.Value
+		if vm.op == OpShl {
+			v = left.Value << right.Value
+		}
+		vm.Push(&interp.Integer{Primitive: interp.Primitive[int]{Value: v}})
+		return nil
+	})
+}
+
+// comparableObj pushes the result of test, operands of different types
+// are never equal.
 func comparableObj(vm *Vm, test func(l, r interp.Object) bool) error {
 	left, right, err := vm.pop2()
 	if err != nil {
 		return err
 	}
-	if left.Type() != right.Type() {
-		return fmt.Errorf("not the same object type, left=%q and right=%q",
-			left.Inspect(), right.Inspect())
-	}
-	if test(left, right) {
-		vm.Push(interp.TrueObject)
-	} else {
-		vm.Push(interp.FalseObject)
-	}
+	vm.Push(nativeBoolToObject(test(left, right)))
 	return nil
 }
 
 func eqObj(vm *Vm) error {
+	return comparableObj(vm, interp.Equal)
+}
+
+func neqObj(vm *Vm) error {
 	return comparableObj(vm, func(l, r interp.Object) bool {
-		switch left := l.(type) {
-		case *interp.Integer:
-			right := r.(*interp.Integer)
-			return left.Value == right.Value
-		case *interp.Boolean:
-			right := r.(*interp.Boolean)
-			return left.Value == right.Value
-		}
-		return false
+		return !interp.Equal(l, r)
 	})
 }
 
 func notObj(vm *Vm, obj interp.Object) error {
-	switch b := obj.(type) {
-	case *interp.Boolean:
-		if b.Value {
-			vm.Push(interp.FalseObject)
-		} else {
-			vm.Push(interp.TrueObject)
-		}
-		return nil
-	case *interp.Integer:
-		if b.Value == 0 {
-			vm.Push(interp.TrueObject)
-		} else {
-			vm.Push(interp.FalseObject)
-		}
-		return nil
-	case *interp.Null:
-		vm.Push(interp.TrueObject)
-		return nil
-	default:
-		return fmt.Errorf("cannot be applied for not-equality. got=%T (%+v)",
-			obj, obj)
-	}
+	vm.Push(nativeBoolToObject(!interp.IsTruthy(obj)))
+	return nil
 }
 
-func neqObj(vm *Vm) error {
-	if err := eqObj(vm); err != nil {
-		return err
+func nativeBoolToObject(b bool) interp.Object {
+	if b {
+		return interp.TrueObject
 	}
-	lastBool, err := vm.Pop()
-	if err != nil {
-		return err
-	}
-	return notObj(vm, lastBool)
+	return interp.FalseObject
 }
 
-func orderableObj(vm *Vm, test func(l, r *interp.Integer) bool) error {
+func orderableObj(vm *Vm, test func(c int) bool) error {
 	left, right, err := vm.pop2()
 	if err != nil {
 		return err
 	}
-	if left.Type() != right.Type() {
-		return fmt.Errorf("not the same object type, left=%q and right=%q",
-			left.Inspect(), right.Inspect())
+	compare := interp.Compare
+	if vm.collate {
+		compare = interp.CompareCollated
 	}
-	switch lobj := left.(type) {
-	case *interp.Integer:
-		robj := right.(*interp.Integer)
-		if test(lobj, robj) {
-			vm.Push(interp.TrueObject)
-			return nil
-		}
-		vm.Push(interp.FalseObject)
+	c, ok := compare(left, right)
+	if !ok {
+		return newRuntimeError(interp.KindTypeMismatch,
+			fmt.Sprintf("unknown operator: %s %s %s", left.Type(), opSymbols[vm.op], right.Type()),
+			left, right)
 	}
+	vm.Push(nativeBoolToObject(c != interp.Unordered && test(c)))
 	return nil
 }
 
 func gtObj(vm *Vm) error {
-	return orderableObj(vm, func(l, r *interp.Integer) bool {
-		return l.Value > r.Value
-	})
+	return orderableObj(vm, func(c int) bool { return c > 0 })
 }
 
 func ltObj(vm *Vm) error {
-	return orderableObj(vm, func(l, r *interp.Integer) bool {
-		return l.Value < r.Value
-	})
+	return orderableObj(vm, func(c int) bool { return c < 0 })
 }
 
 func gteObj(vm *Vm) error {
-	return orderableObj(vm, func(l, r *interp.Integer) bool {
-		return l.Value >= r.Value
-	})
+	return orderableObj(vm, func(c int) bool { return c >= 0 })
 }
 
 func lteObj(vm *Vm) error {
-	return orderableObj(vm, func(l, r *interp.Integer) bool {
-		return l.Value <= r.Value
-	})
-}
-
-func isTruthy(o interp.Object) bool {
-	switch b := o.(type) {
-	case *interp.Boolean:
-		return b.Value
-	case *interp.Integer:
-		return b.Value != 0
-	case *interp.Null:
-		return false
-	default:
-		return true
-	}
+	return orderableObj(vm, func(c int) bool { return c <= 0 })
 }
 
 func processIndex(vm *Vm) error {
@@ -566,8 +910,9 @@ func processIndex(vm *Vm) error {
 	case *interp.SliceObj:
 		idn, ok := idx.(*interp.Integer)
 		if !ok {
-			return fmt.Errorf("index accessing array is not integer. got=%T (%+v)",
-				idx, idx)
+			return newRuntimeError(interp.KindTypeMismatch,
+				fmt.Sprintf("index accessing array is not integer. got=%s", idx.Type()),
+				left, idx)
 		}
 		if idn.Value >= len(lobj.Elements) || idn.Value < 0 {
 			vm.Push(interp.NullObject)
@@ -577,8 +922,9 @@ func processIndex(vm *Vm) error {
 	case *interp.String:
 		idn, ok := idx.(*interp.Integer)
 		if !ok {
-			return fmt.Errorf("index accessing string is not integer. got=%T (%+v)",
-				idx, idx)
+			return newRuntimeError(interp.KindTypeMismatch,
+				fmt.Sprintf("index accessing string is not integer. got=%s", idx.Type()),
+				left, idx)
 		}
 		strlen := utf8.RuneCountInString(lobj.Value)
 		if idn.Value >= strlen || idn.Value < 0 {
@@ -600,7 +946,8 @@ func processIndex(vm *Vm) error {
 	case *interp.Hash:
 		h, ok := idx.(interp.Hashable)
 		if !ok {
-			return fmt.Errorf("unusable key as hash: %s", idx.Inspect())
+			return newRuntimeError(interp.KindUnhashableKey,
+				fmt.Sprintf("unusable as hash key: %s", idx.Type()), idx)
 		}
 		o, ok := lobj.Pairs[h.HashKey()]
 		if !ok {
@@ -608,21 +955,30 @@ func processIndex(vm *Vm) error {
 			return nil
 		}
 		vm.Push(o.Value)
+	default:
+		return newRuntimeError(interp.KindTypeMismatch,
+			fmt.Sprintf("index operator not supported: %s", left.Type()), left, idx)
 	}
 	return nil
 }
 
 func callFunction(vm *Vm, fn *Closure, arity int) error {
 	if fn.Fn.NumArgs != int(arity) {
-		return fmt.Errorf("wrong argument number: want=%d, got=%d",
-			fn.Fn.NumArgs, arity)
+		return newRuntimeError(interp.KindArity,
+			fmt.Sprintf("wrong argument number: want=%d, got=%d",
+				fn.Fn.NumArgs, arity), fn)
+	}
+	if len(vm.Stack)+fn.Fn.NumLocals > vm.maxStack {
+		return vm.stackOverflow()
 	}
 	frame := NewFrame(fn, len(vm.Stack)-int(arity))
-	vm.sp = frame.basePointer + fn.Fn.NumLocals
-	if vm.sp < len(vm.Stack) {
-		fmt.Println("TODO: investigate call-function stack strange")
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+	// the arguments are the first locals, the others start as null
+	for range fn.Fn.NumLocals - arity {
+		vm.Push(interp.NullObject)
 	}
-	vm.pushFrame(frame)
 	return nil
 }
 
@@ -632,6 +988,13 @@ func callBuiltin(vm *Vm, fn *interp.Builtin, arity int) error {
 	if result == nil {
 		result = interp.NullObject
 	}
+	if err, ok := result.(*interp.Error); ok {
+		if err.Kind == interp.KindThrown {
+			return newRuntimeError(interp.KindThrown, err.Msg, err.Value)
+		}
+		return newRuntimeError(err.Kind, err.Msg, args...)
+	}
+	vm.Stack = vm.Stack[:len(vm.Stack)-arity-1]
 	vm.Push(result)
 	return nil
 }
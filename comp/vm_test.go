@@ -2,8 +2,15 @@ package comp
 
 import (
 	"compgo/interp"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 type vmTestCase struct {
@@ -22,6 +29,11 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 		}
 		vm := NewVm(comp.Bytecode())
 		err = vm.Run()
+		var rerr *RuntimeError
+		if _, ok := tt.expected.(*interp.Error); ok && errors.As(err, &rerr) {
+			testExpectedObject(t, tt.expected, rerr.Object())
+			continue
+		}
 		if err != nil {
 			t.Fatalf("vm error: %s", err)
 		}
@@ -38,6 +50,11 @@ func testExpectedObject(t *testing.T, expected any, actual interp.Object) {
 		if err != nil {
 			t.Errorf("integer object test fail: %s", err)
 		}
+	case float64:
+		err := testFloatObject(exp, actual)
+		if err != nil {
+			t.Errorf("float object test fail: %s", err)
+		}
 	case bool:
 		err := testBooleanObject(exp, actual)
 		if err != nil {
@@ -154,6 +171,39 @@ func TestIntegerArithVm(t *testing.T) {
 		{"-1 * 10", -10},
 		{"-50 + 100 + -50", 0},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"1 << 4", 16},
+		{"-16 >> 2", -4},
+	}
+	runVmTests(t, tests)
+}
+
+func TestFloatVm(t *testing.T) {
+	tests := []vmTestCase{
+		{"3.14", 3.14},
+		{"-2.5", -2.5},
+		{"0.1 + 0.2", 0.30000000000000004},
+		{"7 / 2.0", 3.5},
+		{"1.5 * 2", 3.0},
+		{"2 - 0.5", 1.5},
+		{"7.5 % 2", 1.5},
+		{"2.0 ** -1", 0.5},
+		{"1 == 1.0", true},
+		{"1 < 1.5", true},
+		{"2.5 >= 3", false},
+		{`{1: "a"}[1.0]`, "a"},
+		{"int(2.9)", 2},
+		{`float("1e3")`, 1000.0},
+		{"1.5 & 1", &interp.Error{Msg: "unknown operator: FLOAT & INTEGER"}},
+		{"1.0 / 0", &interp.Error{Msg: "division by zero: 1.0 / 0.0"}},
+		{"1.0 / -0.0", &interp.Error{Msg: "division by zero: 1.0 / -0.0"}},
+		{"int(1e300)", &interp.Error{Msg: "cannot convert 1e+300 to int"}},
 	}
 	runVmTests(t, tests)
 }
@@ -177,6 +227,91 @@ func TestBooleanVm(t *testing.T) {
 		{"!!true", true},
 		{"!!false", false},
 		{"!!5", true},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`1 == "1"`, false},
+		{`1 != true`, true},
+		{"if (false) { 1 } == if (false) { 2 }", true},
+		{`[1, "a", [true]] == [1, "a", [true]]`, true},
+		{`[1, 2] == [1]`, false},
+		{`{"a": [1]} == {"a": [1]}`, true},
+		{`{"a": 1} != {"a": 2}`, true},
+		{`!"a"`, false},
+		{`"a" < "b"`, true},
+		{`"b" <= "abc"`, false},
+		{`"abc" > "ab"`, true},
+		{`"異" >= "異"`, true},
+		{`compare("a", "b")`, -1},
+		{`compare(2, 1)`, 1},
+	}
+	runVmTests(t, tests)
+}
+
+func TestVm_collate(t *testing.T) {
+	tests := []vmTestCase{
+		{`"Z" < "a"`, false},
+		{`"é" < "f"`, true},
+		{`"a" < "A"`, true},
+		{`"ab" > "Aa"`, true},
+	}
+	for _, tt := range tests {
+		vm := newTestVm(t, tt.input)
+		vm.SetCollate(true)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPop())
+	}
+}
+
+func TestVm_bigInt(t *testing.T) {
+	tests := []struct {
+		input    string
+		plain    string
+		promoted string
+	}{
+		{"9223372036854775807 + 1", "-9223372036854775808", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "9223372036854775807", "-9223372036854775809"},
+		{"4294967296 * 4294967296", "0", "18446744073709551616"},
+		{"2 ** 64", "0", "18446744073709551616"},
+		{"1 << 63", "-9223372036854775808", "9223372036854775808"},
+		{"-(-9223372036854775807 - 1)", "-9223372036854775808", "9223372036854775808"},
+		{"99999999999999999999 - 99999999999999999998", "1", "1"},
+		{"~99999999999999999999", "-100000000000000000000", "-100000000000000000000"},
+		{"99999999999999999999 > 1", "true", "true"},
+		{`{99999999999999999999: "a"}[99999999999999999999]`, `"a"`, `"a"`},
+	}
+	for _, tt := range tests {
+		for _, on := range []bool{false, true} {
+			vm := newTestVm(t, tt.input)
+			vm.SetBigInt(on)
+			if err := vm.Run(); err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			want := tt.plain
+			if on {
+				want = tt.promoted
+			}
+			if got := vm.LastPop().Inspect(); got != want {
+				t.Errorf("%s (big=%t): wrong value. want=%s got=%s", tt.input, on, want, got)
+			}
+		}
+	}
+}
+
+func TestLogicalVm(t *testing.T) {
+	tests := []vmTestCase{
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && 2", true},
+		{`0 || ""`, true},
+		{"1 < 2 && 2 < 3 || false", true},
+		{"false && 1 / 0", false},
+		{"true || 1 / 0", true},
+		{`let f = fn() { throw("called") }; false && f()`, false},
+		{"if (1 > 2 || 3 > 2) { 10 } else { 20 }", 10},
 	}
 	runVmTests(t, tests)
 }
@@ -373,6 +508,96 @@ func TestFunctionVm_argsBinding(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestFunctionVm_manyLocals(t *testing.T) {
+	tests := []vmTestCase{
+		{`let f = fn(a, b) {
+			let c = a + b;
+			let d = c * 2;
+			let e = d - a;
+			let g = [a, b, c, d, e];
+			let h = len(g);
+			a + b + c + d + e + h;
+		};
+		f(1, 2)`, 22},
+		{`let sq = fn(x) { let y = x * x; y };
+		let f = fn() {
+			let a = sq(2);
+			let b = sq(a);
+			let c = sq(3) + sq(4);
+			[a, b, c];
+		};
+		f()`, []int{4, 16, 25}},
+		{`let f = fn(n) {
+			if (n > 0) { let a = n; let b = a + 1; }
+			let c = 10;
+			[a, c];
+		};
+		f(0)`, []any{nil, 10}},
+		{`let f = fn(n) {
+			let a = 1;
+			let g = fn(x) { let b = x + a; b * 2 };
+			let c = g(n) + g(a);
+			c;
+		};
+		f(3) + f(4)`, 26},
+		{`let mk = fn(a) {
+			let b = a * 2;
+			let c = b + 1;
+			fn(d) { let e = d + c; [a, b, c, e] };
+		};
+		mk(1)(10)`, []int{1, 2, 3, 13}},
+		{`let fact = fn(n) {
+			let m = n - 1;
+			if (n < 2) { return 1 }
+			let r = fact(m);
+			n * r;
+		};
+		fact(10)`, 3628800},
+	}
+	runVmTests(t, tests)
+
+	vm := newTestVm(t, `let f = fn(a) { let b = a; let c = b; c }; f(1); f(2); f(3)`)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if len(vm.Stack) != 0 {
+		t.Errorf("stack not emptied by returns. got=%d values", len(vm.Stack))
+	}
+}
+
+func TestVm_wideOperands(t *testing.T) {
+	var names, lets, elements []string
+	for i := range 300 {
+		names = append(names, fmt.Sprintf("a%d", i))
+		lets = append(lets, fmt.Sprintf("let a%d = %d;", i, i))
+	}
+	for i := range 70000 {
+		elements = append(elements, strconv.Itoa(i))
+	}
+	args := strings.Join(names, ", ")
+	sum := strings.Join(names, " + ")
+	tests := []vmTestCase{
+		// locals, parameters and arguments past 255
+		{"fn() { " + strings.Join(lets, " ") + " a0 + a299 }()", 299},
+		{"fn() { " + strings.Join(lets, " ") + " fn(" + args + ") { a0 + a299 }(" + args + ") }()", 299},
+		// free variables past 255
+		{"fn() { " + strings.Join(lets, " ") + " fn() { " + sum + " } }()()", 44850},
+		// jumps past 65535
+		{"let n = 0; for (let i = 0; i < 3; i += 1) { if (i == 1) { " +
+			strings.Repeat("n; ", 20000) + "} else { n += 1 } }; n", 2},
+		{"fn(x) { if (x) { " + strings.Repeat("x; ", 20000) + "1 } else { 2 } }(false)", 2},
+	}
+	runVmTests(t, tests)
+
+	// constants and array elements past 65535, more than the default stack
+	vm := newTestVm(t, "let a = ["+strings.Join(elements, ", ")+"]; len(a) + a[69999]")
+	vm.SetMaxStack(1 << 17)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 139999, vm.LastPop())
+}
+
 func TestFunctionVm_wrongArgNum(t *testing.T) {
 	tests := []vmTestCase{
 		{`fn(){1;}(1)`, `wrong argument number: want=0, got=1`},
@@ -388,10 +613,52 @@ func TestFunctionVm_wrongArgNum(t *testing.T) {
 		if err == nil {
 			t.Fatal("expected vm but resulted none")
 		}
-		if err.Error() != tt.expected {
-			t.Fatalf("wrong vm error message: want=%q got=%q", tt.expected, err.Error())
+		var rerr *RuntimeError
+		if !errors.As(err, &rerr) {
+			t.Fatalf("error is not runtime error. got=%T (%+v)", err, err)
+		}
+		if rerr.Err.Error() != tt.expected {
+			t.Fatalf("wrong vm error message: want=%q got=%q", tt.expected, rerr.Err.Error())
+		}
+	}
+}
+
+func TestRuntimeError_position(t *testing.T) {
+	input := `let add = fn(a, b) {
+	a + b
+};
+let wrapper = fn() {
+  add(1, true);
+};
+wrapper();`
+	compiler := New()
+	compiler.SetFile("adder.mk")
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	vm := NewVm(compiler.Bytecode())
+	err := vm.Run()
+	var rerr *RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("error is not runtime error. got=%T (%+v)", err, err)
+	}
+	expected := []TraceFrame{
+		{"add", Position{"adder.mk", 2, 4}},
+		{"wrapper", Position{"adder.mk", 5, 6}},
+		{"<main>", Position{"adder.mk", 7, 8}},
+	}
+	if len(rerr.Trace) != len(expected) {
+		t.Fatalf("wrong trace length. want=%d got=%d\n%s",
+			len(expected), len(rerr.Trace), rerr)
+	}
+	for i, f := range expected {
+		if rerr.Trace[i] != f {
+			t.Errorf("wrong trace frame %d. want=%s got=%s", i, f, rerr.Trace[i])
 		}
 	}
+	if !strings.HasPrefix(rerr.Error(), "adder.mk:2:4: unknown operator") {
+		t.Errorf("error does not start with position. got=%q", rerr.Error())
+	}
 }
 
 func TestBuiltinVm(t *testing.T) {
@@ -399,6 +666,7 @@ func TestBuiltinVm(t *testing.T) {
 		{`len("")`, 0},
 		{`len([])`, 0},
 		{`len("異世界")`, 3},
+		{`1 + len([1, 2]) * len("ab")`, 5},
 		{`len(["異", "世", "界"])`, 3},
 		{`len(1)`, &interp.Error{
 			Msg: "argument to 'len' not supported, got INTEGER"}},
@@ -463,6 +731,26 @@ func TestClosureVm(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestAssignVm(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; x = 5; x", 5},
+		{"let x = 1; x = 5", 5},
+		{"let x = 2; x **= 3; x -= 1; x", 7},
+		{"let a = 0; let b = 0; a = b = 3; a + b", 6},
+		{"let x = 1; let f = fn() { x = 10 }; f(); x", 10},
+		{"let x = 1; let f = fn(x) { x = 10 }; f(2); x", 1},
+		{"let f = fn() { let a = 1; a += 2; a }; f()", 3},
+		{"let c = fn() { let n = 0; fn() { n += 1 } }(); c(); c()", 2},
+		{"let mk = fn() { let n = 0; let inc = fn() { n += 1 }; inc(); inc(); n }; mk()", 2},
+		{"let mk = fn() { let n = 0; [fn() { n += 10 }, fn() { n }] }; let p = mk(); p[0](); p[0](); p[1]()", 20},
+		{"let mk = fn(a) { fn() { fn() { a = a * 2 } } }; let f = mk(3); let g = f(); g(); g(); f()()", 24},
+		{"let f = fn(a, b) { fn(x) { b + b + x } }; f(1, 2)(3)", 7},
+		{"let x = 1; x += (x = 10); x", 11},
+		{`let x = 1; try { x = 1 / 0 } catch (e) { 0 }; x`, 1},
+	}
+	runVmTests(t, tests)
+}
+
 func TestClosureVm_recursive(t *testing.T) {
 	tests := []vmTestCase{
 		{`let countdown = fn(x) {
@@ -516,3 +804,320 @@ fibonacci(15);
 	}
 	runVmTests(t, tests)
 }
+
+func TestRuntimeError_kinds(t *testing.T) {
+	tests := []struct {
+		input  string
+		kind   interp.ErrorKind
+		op     Opcode
+		values []string
+	}{
+		{`1 + true`, interp.KindTypeMismatch, OpAdd, []string{"1", "true"}},
+		{`"a" - "b"`, interp.KindTypeMismatch, OpSub, []string{`"a"`, `"b"`}},
+		{`-"a"`, interp.KindTypeMismatch, OpMinus, []string{`"a"`}},
+		{`1(2)`, interp.KindTypeMismatch, OpCall, []string{"1"}},
+		{`1[0]`, interp.KindTypeMismatch, OpIndex, []string{"1", "0"}},
+		{`fn(a) { a }()`, interp.KindArity, OpCall, nil},
+		{`{[1]: 2}`, interp.KindUnhashableKey, OpHash, []string{"[1]"}},
+		{`{1: 2}[[1]]`, interp.KindUnhashableKey, OpIndex, []string{"[1]"}},
+		{`10 / (5 - 5)`, interp.KindDivisionByZero, OpDiv, []string{"10", "0"}},
+	}
+	for _, tt := range tests {
+		compiler := New()
+		if err := compiler.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compile error: %s", err)
+		}
+		err := NewVm(compiler.Bytecode()).Run()
+		var rerr *RuntimeError
+		if !errors.As(err, &rerr) {
+			t.Fatalf("%s: error is not runtime error. got=%T (%+v)", tt.input, err, err)
+		}
+		if rerr.Kind != tt.kind {
+			t.Errorf("%s: wrong kind. want=%s got=%s", tt.input, tt.kind, rerr.Kind)
+		}
+		if rerr.Op != tt.op {
+			t.Errorf("%s: wrong opcode. want=%s got=%s", tt.input,
+				definitions[tt.op].Name, definitions[rerr.Op].Name)
+		}
+		if tt.values == nil {
+			continue
+		}
+		if len(rerr.Values) != len(tt.values) {
+			t.Errorf("%s: wrong number of values. want=%d got=%d",
+				tt.input, len(tt.values), len(rerr.Values))
+			continue
+		}
+		for i, v := range tt.values {
+			if rerr.Values[i].Inspect() != v {
+				t.Errorf("%s: wrong value %d. want=%s got=%s",
+					tt.input, i, v, rerr.Values[i].Inspect())
+			}
+		}
+	}
+}
+
+func TestRuntimeError_stackUnderflow(t *testing.T) {
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	vm := NewVm(&Bytecode{Instructions: Make(OpAdd)})
+	err = vm.Run()
+	os.Stdout = stdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+	if len(out) != 0 {
+		t.Errorf("vm wrote to stdout: %q", out)
+	}
+	var rerr *RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("error is not runtime error. got=%T (%+v)", err, err)
+	}
+	if rerr.Kind != interp.KindStackUnderflow || !errors.Is(err, ErrEmptyStack) {
+		t.Errorf("wrong error. want stack underflow got=%s (%s)", rerr.Kind, err)
+	}
+	if len(rerr.Trace) != 1 || rerr.Trace[0].Function != mainName {
+		t.Errorf("wrong trace. got=%+v", rerr.Trace)
+	}
+}
+
+func TestTryCatchVm(t *testing.T) {
+	tests := []vmTestCase{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { 1 + true } catch (e) { 2 }`, 2},
+		{`try { 1 + true } catch (e) { e["message"] }`, "unknown operator: INTEGER + BOOLEAN"},
+		{`try { 1 + true } catch (e) { e["kind"] }`, "TYPE_MISMATCH"},
+		{`try { throw("boom") } catch (e) { e["message"] }`, "boom"},
+		{`try { throw("boom") } catch (e) { e["kind"] }`, "THROWN"},
+		{`try { throw({"code": 7}) } catch (e) { e["value"]["code"] }`, 7},
+		{`let f = fn() { throw("in fn"); 1 }; try { f() } catch (e) { e["message"] }`, "in fn"},
+		{`let f = fn(n) { if (n == 0) { 1 + true } else { f(n - 1) } }; try { f(5) } catch (e) { e["kind"] }`, "TYPE_MISMATCH"},
+		{`try { try { throw(1) } catch (e) { throw(e["value"] + 1) } } catch (e) { e["value"] }`, 2},
+		{`let f = fn() { try { return 5 } catch (e) { 0 } }; f(); try { throw(1) } catch (e) { 6 }`, 6},
+		{`let f = fn() { let a = 1; try { a + true } catch (e) { a + 1 } }; f()`, 2},
+		{`1 + try { [2, 3, 2 + true] } catch (e) { 10 }`, 11},
+		{`try { 1 / 0 } catch (e) { e["kind"] }`, "DIVISION_BY_ZERO"},
+		{`try { } catch (e) { 1 }`, nil},
+		{`try { 1 } catch (e) { }`, 1},
+	}
+	runVmTests(t, tests)
+}
+
+func TestLoopVm(t *testing.T) {
+	tests := []vmTestCase{
+		{"let i = 0; while (i < 5) { let i = i + 1 }; i", 5},
+		{`let s = 0; for (let i = 0; i < 10; let i = i + 1) {
+			if (i % 2 == 0) { continue }
+			if (i > 7) { break }
+			let s = s + i;
+		}; s`, 16},
+		{"let n = 0; for (;;) { let n = n + 1; if (n == 3) { break } }; n", 3},
+		{"while (false) { 1 }", nil},
+		{"let f = fn() { while (true) { return 7 } }; f()", 7},
+		{"let i = 0; while (i < 3) { try { let i = i + 1; break } catch (e) { 0 } }; i", 1},
+		{`let n = 0; for (; n < 3; let n = n + 1) { try { continue } catch (e) { 0 } }; try { throw(n) } catch (e) { e["value"] }`, 3},
+		{`try { while (true) { 1 + true } } catch (e) { e["kind"] }`, "TYPE_MISMATCH"},
+	}
+	runVmTests(t, tests)
+
+	vm := newTestVm(t, "while (true) { }")
+	vm.SetMaxInstructions(1000)
+	if err := vm.Run(); !errors.Is(err, ErrInstructionLimit) {
+		t.Errorf("wrong error. want instruction limit got=%v", err)
+	}
+}
+
+func TestThrowUncaughtVm(t *testing.T) {
+	compiler := New()
+	if err := compiler.Compile(parse(`let f = fn() { throw("boom") }; try { 1 } catch (e) { 2 }; f()`)); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	err := NewVm(compiler.Bytecode()).Run()
+	var rerr *RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("error is not runtime error. got=%T (%+v)", err, err)
+	}
+	if rerr.Kind != interp.KindThrown {
+		t.Errorf("wrong kind. want=%s got=%s", interp.KindThrown, rerr.Kind)
+	}
+	if rerr.Err.Error() != "boom" {
+		t.Errorf("wrong message. want=%q got=%q", "boom", rerr.Err.Error())
+	}
+	if len(rerr.Values) != 1 || rerr.Values[0].Inspect() != `"boom"` {
+		t.Errorf("wrong thrown value. got=%v", rerr.Values)
+	}
+}
+
+func TestRuntimeError_panic(t *testing.T) {
+	// constant index out of range panics inside the opcode
+	vm := NewVm(&Bytecode{Instructions: Make(OpConstant, 5)})
+	err := vm.Run()
+	var rerr *RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("error is not runtime error. got=%T (%+v)", err, err)
+	}
+	if rerr.Kind != interp.KindInternal || rerr.Op != OpConstant {
+		t.Errorf("wrong error. want internal error at OpConstant got=%s at %s",
+			rerr.Kind, definitions[rerr.Op].Name)
+	}
+	if !strings.HasPrefix(rerr.Err.Error(), "internal error: ") {
+		t.Errorf("wrong message. got=%q", rerr.Err.Error())
+	}
+}
+
+const fibonacciSrc = `
+let fibonacci = fn(x) {
+	if (x < 2) { x } else { fibonacci(x - 1) + fibonacci(x - 2) }
+};
+`
+
+func newTestVm(t *testing.T, input string) *Vm {
+	t.Helper()
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	return NewVm(compiler.Bytecode())
+}
+
+func TestVm_maxInstructions(t *testing.T) {
+	vm := newTestVm(t, fibonacciSrc+"fibonacci(10)")
+	vm.SetMaxInstructions(100000)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error within budget: %s", err)
+	}
+	testExpectedObject(t, 55, vm.LastPop())
+
+	tests := []string{
+		fibonacciSrc + "fibonacci(20)",
+		fibonacciSrc + "try { fibonacci(20) } catch (e) { 0 }",
+	}
+	for _, input := range tests {
+		vm := newTestVm(t, input)
+		vm.SetMaxInstructions(1000)
+		err := vm.Run()
+		var rerr *RuntimeError
+		if !errors.As(err, &rerr) {
+			t.Fatalf("error is not runtime error. got=%T (%+v)", err, err)
+		}
+		if rerr.Kind != interp.KindBudgetExceeded || !errors.Is(err, ErrInstructionLimit) {
+			t.Errorf("wrong error. want instruction limit got=%s (%s)", rerr.Kind, err)
+		}
+	}
+}
+
+func TestVm_runContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	vm := newTestVm(t, fibonacciSrc+"fibonacci(1)")
+	err := vm.RunContext(ctx)
+	var rerr *RuntimeError
+	if !errors.As(err, &rerr) || rerr.Kind != interp.KindCancelled ||
+		!errors.Is(err, context.Canceled) {
+		t.Errorf("wrong error. want cancelled got=%T (%+v)", err, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	vm = newTestVm(t, fibonacciSrc+"try { fibonacci(35) } catch (e) { 0 }")
+	err = vm.RunContext(ctx)
+	if !errors.As(err, &rerr) || rerr.Kind != interp.KindCancelled ||
+		!errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong error. want deadline exceeded got=%T (%+v)", err, err)
+	}
+}
+
+func TestVm_stackOverflow(t *testing.T) {
+	vm := newTestVm(t, "let f = fn() { f() };\nf()")
+	err := vm.Run()
+	var rerr *RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("error is not runtime error. got=%T (%+v)", err, err)
+	}
+	if rerr.Kind != interp.KindStackOverflow {
+		t.Fatalf("wrong kind. want=%s got=%s", interp.KindStackOverflow, rerr.Kind)
+	}
+	if len(rerr.Trace) != MaxFrames {
+		t.Errorf("wrong trace length. want=%d got=%d", MaxFrames, len(rerr.Trace))
+	}
+	if f := rerr.Trace[0]; f.Function != "f" || f.Line != 1 {
+		t.Errorf("wrong innermost frame. got=%s", f)
+	}
+	if f := rerr.Trace[len(rerr.Trace)-1]; f.Function != mainName || f.Line != 2 {
+		t.Errorf("wrong outermost frame. got=%s", f)
+	}
+	want := fmt.Sprintf("\n\t... repeated %d more times\n\tat <main>", MaxFrames-2)
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("recursion is not collapsed. got=%q", err.Error())
+	}
+
+	vm = newTestVm(t, `let f = fn() { f() }; try { f() } catch (e) { e["kind"] }`)
+	vm.SetMaxFrames(10)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, "STACK_OVERFLOW", vm.LastPop())
+}
+
+func TestVm_maxFramesAndStack(t *testing.T) {
+	countdown := `
+let countdown = fn(n) { if (n == 0) { 0 } else { countdown(n - 1) } };
+countdown(1500)`
+	vm := newTestVm(t, countdown)
+	vm.SetMaxFrames(2000)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 0, vm.LastPop())
+
+	vm = newTestVm(t, countdown)
+	vm.SetMaxFrames(2000)
+	vm.SetMaxStack(100)
+	err := vm.Run()
+	var rerr *RuntimeError
+	if !errors.As(err, &rerr) || rerr.Kind != interp.KindStackOverflow {
+		t.Fatalf("wrong error. want stack overflow got=%T (%+v)", err, err)
+	}
+	if msg := rerr.Err.Error(); msg != "stack overflow: stack size 100 exceeded" {
+		t.Errorf("wrong message. got=%q", msg)
+	}
+
+	// values pushed by a single expression count too
+	vm = newTestVm(t, "["+strings.Repeat("1, ", 200)+"1]")
+	vm.SetMaxStack(100)
+	if err := vm.Run(); !errors.As(err, &rerr) || rerr.Kind != interp.KindStackOverflow {
+		t.Fatalf("wrong error. want stack overflow got=%T (%+v)", err, err)
+	}
+}
+
+func TestVm_bytecodeIsReusable(t *testing.T) {
+	tests := []vmTestCase{
+		{`-5`, -5},
+		{`let a = 5; -a; a`, 5},
+		{`let f = fn() { -5 }; f() + f()`, -10},
+		{`rest([1, 2, 3])`, []any{2, 3}},
+		{`let a = [1, 2, 3]; rest(a); a`, []any{1, 2, 3}},
+		{`push([1], 2)`, []any{1, 2}},
+		{`let a = [1]; push(a, 2); a`, []any{1}},
+		{`push("a", "b", 1, true)`, "ab1true"},
+		{`let a = "a"; push(a, "b"); a`, "a"},
+		{`let f = fn() { push([1], 2) }; f(); f()`, []any{1, 2}},
+	}
+	for _, tt := range tests {
+		prg := parse(tt.input)
+		comp := New()
+		if err := comp.Compile(prg); err != nil {
+			t.Fatalf("compile error: %s", err)
+		}
+		b := comp.Bytecode()
+		for range 3 {
+			vm := NewVm(b)
+			if err := vm.Run(); err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			testExpectedObject(t, tt.expected, vm.LastPop())
+		}
+	}
+}
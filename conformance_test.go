@@ -0,0 +1,212 @@
+package compgo
+
+import (
+	"compgo/interp"
+	"testing"
+)
+
+// conformanceCase is a program with the result both engines must agree
+// on: the inspected value, or the error kind when kind is set.
+type conformanceCase struct {
+	input string
+	want  string
+	kind  interp.ErrorKind
+}
+
+const null = `let null = if (false) { 1 };`
+
+var conformanceCases = []conformanceCase{
+	// arithmetic
+	{input: `1 + 2 * 3 - 8 / 2`, want: "3"},
+	{input: `-(5 - 10)`, want: "5"},
+	{input: `"ab" + "cd"`, want: `"abcd"`},
+	{input: `[1, 2] + [3]`, want: "[1,2,3]"},
+	{input: `1 + "a"`, kind: interp.KindTypeMismatch},
+	{input: `"a" - "b"`, kind: interp.KindTypeMismatch},
+	{input: `[1] * 2`, kind: interp.KindTypeMismatch},
+	{input: `true / false`, kind: interp.KindTypeMismatch},
+	{input: `1 / 0`, kind: interp.KindDivisionByZero},
+	{input: `-"a"`, kind: interp.KindTypeMismatch},
+	{input: `-true`, kind: interp.KindTypeMismatch},
+	{input: `17 % 5 + 2 ** 3 ** 2`, want: "514"},
+	{input: `-17 % 5`, want: "-2"},
+	{input: `(12 & 10) | (1 ^ 3) << 2`, want: "8"},
+	{input: `~0 >> 70`, want: "-1"},
+	{input: `1 << 64`, want: "0"},
+	{input: `~true`, kind: interp.KindTypeMismatch},
+	{input: `"a" ** 2`, kind: interp.KindTypeMismatch},
+	{input: `[1] & [1]`, kind: interp.KindTypeMismatch},
+	{input: `1 % 0`, kind: interp.KindDivisionByZero},
+	{input: `1 << -1`, kind: interp.KindInvalidOperand},
+	{input: `1 >> -1`, kind: interp.KindInvalidOperand},
+	{input: `2 ** -1`, kind: interp.KindInvalidOperand},
+	{input: `try { 1 << -1 } catch (e) { e["kind"] }`, want: `"INVALID_OPERAND"`},
+
+	// equality
+	{input: `1 == 1`, want: "true"},
+	{input: `1 != 2`, want: "true"},
+	{input: `true == true`, want: "true"},
+	{input: `true != false`, want: "true"},
+	{input: `"a" == "a"`, want: "true"},
+	{input: `"a" == "b"`, want: "false"},
+	{input: `"a" != "b"`, want: "true"},
+	{input: null + `null == null`, want: "true"},
+	{input: null + `null != null`, want: "false"},
+	{input: null + `null == 0`, want: "false"},
+	{input: `[1, [2, "x"]] == [1, [2, "x"]]`, want: "true"},
+	{input: `[1, 2] == [1, 2, 3]`, want: "false"},
+	{input: `[1, 2] != [2, 1]`, want: "true"},
+	{input: `{"a": 1, 2: [true]} == {2: [true], "a": 1}`, want: "true"},
+	{input: `{"a": 1} == {"a": 2}`, want: "false"},
+	{input: `{"a": 1} != {"b": 1}`, want: "true"},
+	{input: `{} == {}`, want: "true"},
+	{input: `1 == "1"`, want: "false"},
+	{input: `1 != "1"`, want: "true"},
+	{input: `1 == true`, want: "false"},
+	{input: `[] == {}`, want: "false"},
+	{input: `let f = fn() { 1 }; f == f`, want: "true"},
+	{input: `fn() { 1 } == fn() { 1 }`, want: "false"},
+	{input: `len == len`, want: "true"},
+
+	// ordering
+	{input: `1 < 2`, want: "true"},
+	{input: `2 > 1`, want: "true"},
+	{input: `1 <= 1`, want: "true"},
+	{input: `1 >= 2`, want: "false"},
+	{input: `1 < true`, kind: interp.KindTypeMismatch},
+	{input: `true > false`, kind: interp.KindTypeMismatch},
+	{input: `[1] <= [2]`, kind: interp.KindTypeMismatch},
+	{input: `"a" < "b"`, want: "true"},
+	{input: `"b" > "abc"`, want: "true"},
+	{input: `"ab" <= "ab"`, want: "true"},
+	{input: `"ab" >= "abc"`, want: "false"},
+	{input: `"" < "a"`, want: "true"},
+	{input: `"Z" < "a"`, want: "true"},
+	{input: `"異" > "世"`, want: "true"},
+	{input: `"a" < 1`, kind: interp.KindTypeMismatch},
+	{input: `compare(1, 2)`, want: "-1"},
+	{input: `compare("b", "a")`, want: "1"},
+	{input: `compare("a", "a")`, want: "0"},
+	{input: `compare("a", 1)`, kind: interp.KindTypeMismatch},
+	{input: `compare("a")`, kind: interp.KindArity},
+
+	// floats
+	{input: `0.1 + 0.2`, want: "0.30000000000000004"},
+	{input: `7 / 2.0`, want: "3.5"},
+	{input: `-1.5 * 2`, want: "-3.0"},
+	{input: `2 ** 0.5`, want: "1.4142135623730951"},
+	{input: `7.5 % 2`, want: "1.5"},
+	{input: `1e-9`, want: "1e-09"},
+	{input: `1 == 1.0`, want: "true"},
+	{input: `1.5 > 1`, want: "true"},
+	{input: `compare(2, 1.5)`, want: "1"},
+	{input: `{1: "a"}[1.0]`, want: `"a"`},
+	{input: `{1.0: "a"}[1]`, want: `"a"`},
+	{input: `!0.0`, want: "true"},
+	{input: `1.5 & 1`, kind: interp.KindTypeMismatch},
+	{input: `1.0 / 0`, kind: interp.KindDivisionByZero},
+	{input: `1 % 0.0`, kind: interp.KindDivisionByZero},
+	{input: `int(-2.5)`, want: "-2"},
+	{input: `int("12")`, want: "12"},
+	{input: `int("1.5")`, kind: interp.KindInvalidOperand},
+	{input: `int(1e19)`, kind: interp.KindInvalidOperand},
+	{input: `int([])`, kind: interp.KindTypeMismatch},
+	{input: `float(2)`, want: "2.0"},
+	{input: `float("2.5")`, want: "2.5"},
+	{input: `float("x")`, kind: interp.KindInvalidOperand},
+	{input: `let n = float("nan"); [n < 1, n >= 1, n <= n, n == n, n != n]`, want: "[false,false,false,false,true]"},
+	{input: `let n = 1e308 * 10; n - n == n - n`, want: "false"},
+	{input: `compare(float("nan"), 1)`, kind: interp.KindInvalidOperand},
+
+	// big integers
+	{input: `18446744073709551616`, want: "18446744073709551616"},
+	{input: `18446744073709551616 + 1`, want: "18446744073709551617"},
+	{input: `18446744073709551616 / 4294967296`, want: "4294967296"},
+	{input: `-18446744073709551616 % 7`, want: "-2"},
+	{input: `18446744073709551616 >> 1`, want: "9223372036854775808"},
+	{input: `18446744073709551616 == 18446744073709551616`, want: "true"},
+	{input: `18446744073709551616 < 18446744073709551617`, want: "true"},
+	{input: `compare(1, 18446744073709551616)`, want: "-1"},
+	{input: `float(18446744073709551616)`, want: "1.8446744073709552e+19"},
+	{input: `{18446744073709551616: 1}[18446744073709551616]`, want: "1"},
+	{input: `18446744073709551616 / 0`, kind: interp.KindDivisionByZero},
+	{input: `18446744073709551616 ** -1`, kind: interp.KindInvalidOperand},
+	{input: `1 << 18446744073709551616`, kind: interp.KindInvalidOperand},
+	{input: `18446744073709551616 + "a"`, kind: interp.KindTypeMismatch},
+
+	// logical operators
+	{input: `true && false`, want: "false"},
+	{input: `false || true`, want: "true"},
+	{input: `1 && "a"`, want: "true"},
+	{input: null + `null || 0`, want: "false"},
+	{input: `1 > 2 || 2 > 1 && true`, want: "true"},
+	{input: `false && 1 / 0`, want: "false"},
+	{input: `true || 1 / 0`, want: "true"},
+	{input: `true && 1 / 0`, kind: interp.KindDivisionByZero},
+	{input: `false || throw("x")`, kind: interp.KindThrown},
+
+	// bang and truthiness
+	{input: `!true`, want: "false"},
+	{input: `!0`, want: "true"},
+	{input: `!5`, want: "false"},
+	{input: `!""`, want: "false"},
+	{input: `!"a"`, want: "false"},
+	{input: `![]`, want: "false"},
+	{input: null + `!null`, want: "true"},
+	{input: `!!{}`, want: "true"},
+	{input: `if ("a") { 1 } else { 2 }`, want: "1"},
+	{input: `if ([]) { 1 } else { 2 }`, want: "1"},
+	{input: `if (0) { 1 } else { 2 }`, want: "2"},
+
+	// indexing
+	{input: `[1, 2, 3][1]`, want: "2"},
+	{input: `[1, 2, 3][3]`, want: "<nil>"},
+	{input: `[1, 2, 3][-1]`, want: "<nil>"},
+	{input: `{"a": 1}["a"]`, want: "1"},
+	{input: `{"a": 1}["b"]`, want: "<nil>"},
+	{input: `{1: 2}[[1]]`, kind: interp.KindUnhashableKey},
+	{input: `1[0]`, kind: interp.KindTypeMismatch},
+	{input: `"abc"[1]`, want: `"b"`},
+
+	// loops
+	{input: `let i = 0; while (i < 4) { let i = i + 1 }; i`, want: "4"},
+	{input: `let a = []; for (let i = 0; i < 6; let i = i + 1) { if (i == 1) { continue } if (i == 4) { break } let a = push(a, i) }; a`,
+		want: "[0,2,3]"},
+	{input: `while (false) { 1 }`, want: "<nil>"},
+	{input: `let i = 0; while (true) { let i = i + 1; if (i > 2) { break } }; i`, want: "3"},
+	{input: `for (;;) { 1 / 0 }`, kind: interp.KindDivisionByZero},
+	{input: `let i = 0; while (i < 2) { let i = i + 1; try { throw(i) } catch (e) { continue } }; i`, want: "2"},
+
+	// assignment
+	{input: `let x = 1; x = 2; x`, want: "2"},
+	{input: `let x = 6; x %= 4; x <<= 3; x`, want: "16"},
+	{input: `let s = "a"; s += "b"`, want: `"ab"`},
+	{input: `let x = 1; let f = fn() { x += 1 }; f(); f(); x`, want: "3"},
+	{input: `let c = fn() { let n = 0; fn() { n += 1 } }(); c(); c(); c()`, want: "3"},
+	{input: `let p = fn() { let n = 0; [fn() { n = n + 5 }, fn() { n }] }(); p[0](); p[1]()`, want: "5"},
+	{input: `let x = 1; x /= 0`, kind: interp.KindDivisionByZero},
+	{input: `let x = 1; x += "a"`, kind: interp.KindTypeMismatch},
+}
+
+func TestConformance(t *testing.T) {
+	for _, tt := range conformanceCases {
+		for _, engine := range engines {
+			got, err := New(engine).Eval(tt.input)
+			if tt.kind != "" {
+				if kind := KindOf(err); kind != tt.kind {
+					t.Errorf("%s: %s: wrong error kind. want=%s got=%s (%v)",
+						engine, tt.input, tt.kind, kind, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: %s: unexpected error: %s", engine, tt.input, err)
+				continue
+			}
+			if got.Inspect() != tt.want {
+				t.Errorf("%s: %s: wrong result. want=%s got=%s",
+					engine, tt.input, tt.want, got.Inspect())
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package compgo
+
+import (
+	"compgo/comp"
+	"compgo/interp"
+	"fmt"
+	"testing"
+)
+
+// outcome is what running a program produced on one engine.
+type outcome struct {
+	obj  interp.Object
+	kind interp.ErrorKind
+	err  error
+}
+
+func (o outcome) String() string {
+	if o.err != nil {
+		return fmt.Sprintf("error %s (%s)", o.kind, o.err)
+	}
+	return o.obj.Inspect()
+}
+
+// Generated programs only run bounded loops and never recurse, the limits
+// only guard against a bug in either engine.
+const (
+	diffMaxSteps        = 1_000_000
+	diffMaxInstructions = 1_000_000
+)
+
+func runInterp(prg *interp.Program, bigInt bool) outcome {
+	env := interp.NewEnvironment()
+	opts := interp.EvalOptions{MaxSteps: diffMaxSteps, BigInt: bigInt}
+	obj, err := result(interp.EvalWithOptions(prg, env, opts))
+	return outcome{obj, KindOf(err), err}
+}
+
+func runVm(prg *interp.Program, bigInt, fold bool) outcome {
+	compiler := comp.New()
+	compiler.SetOptions(comp.Options{Fold: fold})
+	if err := compiler.Compile(prg); err != nil {
+		// the only compile error of these programs is an identifier not
+		// in scope, which the interpreter reports when it evaluates it
+		return outcome{kind: interp.KindUndefined, err: err}
+	}
+	vm := comp.NewVm(compiler.Bytecode())
+	vm.SetMaxInstructions(diffMaxInstructions)
+	vm.SetBigInt(bigInt)
+	if err := vm.Run(); err != nil {
+		return outcome{kind: KindOf(err), err: err}
+	}
+	obj, err := result(vm.LastPop())
+	return outcome{obj, KindOf(err), err}
+}
+
+// sameOutcome reports whether both engines agree: equal values, or
+// errors of the same kind. Functions only have to both be callable as
+// each engine has its own function objects.
+func sameOutcome(a, b outcome) bool {
+	if a.err != nil || b.err != nil {
+		return a.err != nil && b.err != nil && a.kind == b.kind
+	}
+	if callable(a.obj) && callable(b.obj) {
+		return true
+	}
+	return interp.Equal(a.obj, b.obj)
+}
+
+func callable(o interp.Object) bool {
+	switch o.(type) {
+	case *interp.Function, *interp.Builtin, *comp.Closure:
+		return true
+	}
+	return false
+}
+
+func diffProgram(t *testing.T, prg *interp.Program) {
+	t.Helper()
+	src := prg.String()
+	iouts := make(map[bool]outcome)
+	for _, bigInt := range []bool{false, true} {
+		iouts[bigInt] = runInterp(prg, bigInt)
+		if vout := runVm(prg, bigInt, false); !sameOutcome(iouts[bigInt], vout) {
+			t.Errorf("engines disagree on\n%s\nwith big integers %t\ninterpreter: %s\nvm: %s",
+				src, bigInt, iouts[bigInt], vout)
+		}
+	}
+	// folding rewrites prg, so it runs last
+	for _, bigInt := range []bool{false, true} {
+		if vout := runVm(prg, bigInt, true); !sameOutcome(iouts[bigInt], vout) {
+			t.Errorf("engines disagree on\n%s\nwith big integers %t and folding\ninterpreter: %s\nvm: %s",
+				src, bigInt, iouts[bigInt], vout)
+		}
+	}
+}
+
+var differentialCorpus = []string{
+	`let a = 5; let b = -a; a`,
+	`let s = "a"; let t = s + "b"; s`,
+	`let xs = [1, 2]; let ys = xs + [3]; xs`,
+	`let f = fn(x) { -x }; f(1) + f(1)`,
+	`let f = fn() { let a = [1, 2, 3]; rest(a) }; f(); f()`,
+	`let f = fn() { push([1], 2) }; f(); f()`,
+	`let f = fn() { "a" == "a" }; [f(), f()]`,
+	`let g = fn() { [] }; g() == g()`,
+	`let h = {"a": [1]}; h == {"a": [1]}`,
+	`if (1 > 2) { 1 } else { let a = 2; }`,
+	`if (true) { let a = 2; }`,
+	`try { [1, 2 + true] } catch (e) { e["kind"] }`,
+	`try { {(9-1): throw("x"), 5: throw("y")} } catch (e) { e["message"] }`,
+	`try { throw(1) } catch (e) { 1 }; e`,
+	`let e = 5; try { throw(1) } catch (e) { let x = e; }; [e, x]`,
+	`let f = fn(e) { try { throw(1) } catch (e) { 1 }; e }; f(2)`,
+	`1 + len([1, 2])`,
+	`len("abc") * len([1])`,
+	`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)`,
+	`let add = fn(a) { fn(b) { a + b } }; add(1)(2)`,
+	`"abc"[5]`,
+	`!"a"`,
+	`!{}`,
+	`first([])`,
+	`rest("")`,
+	`push("a", "b")`,
+	`fn(a) { a }(1, 2)`,
+	`fn(a, b) { a }(1)`,
+	`let f = fn(n) { n * 3037000500 }; [f(3037000500), -f(-3037000500)]`,
+	`9 ** 9 ** 9 << 1`,
+}
+
+func TestDifferential_corpus(t *testing.T) {
+	for _, src := range differentialCorpus {
+		t.Run(src, func(t *testing.T) {
+			p := interp.NewParser(interp.NewLexer(src))
+			prg := p.ParseProgram()
+			if len(p.Errors()) != 0 {
+				t.Fatalf("parse errors: %v", p.Errors())
+			}
+			diffProgram(t, prg)
+		})
+	}
+}
+
+func TestDifferential_random(t *testing.T) {
+	n := 2000
+	if testing.Short() {
+		n = 200
+	}
+	for seed := range int64(n) {
+		diffProgram(t, newProgramGenerator(seed).program())
+	}
+}
+
+// FuzzDifferential explores more generated programs with
+// go test -fuzz=FuzzDifferential.
+func FuzzDifferential(f *testing.F) {
+	f.Add(int64(0))
+	f.Fuzz(func(t *testing.T, seed int64) {
+		diffProgram(t, newProgramGenerator(seed).program())
+	})
+}
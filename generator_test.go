@@ -0,0 +1,305 @@
+package compgo
+
+import (
+	"compgo/interp"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// programGenerator builds random programs out of interp AST nodes for
+// differential testing. Programs only refer to names they defined, so
+// both engines accept them, but they freely mix types to exercise the
+// error paths too.
+type programGenerator struct {
+	rnd      *rand.Rand
+	maxDepth int
+	// scopes are the names visible at each function nesting, the first
+	// one holding the globals.
+	scopes  [][]string
+	counter int
+}
+
+func newProgramGenerator(seed int64) *programGenerator {
+	return &programGenerator{rnd: rand.New(rand.NewSource(seed)), maxDepth: 4}
+}
+
+func (g *programGenerator) program() *interp.Program {
+	g.scopes = [][]string{nil}
+	prg := &interp.Program{}
+	for range g.rnd.Intn(4) {
+		prg.Statements = append(prg.Statements, g.let(0))
+	}
+	prg.Statements = append(prg.Statements, &interp.ExpressionStatement{Expression: g.expr(0)})
+	return prg
+}
+
+func (g *programGenerator) let(depth int) *interp.LetStatement {
+	// the value is generated first, it cannot refer to the new name
+	val := g.expr(depth)
+	name := g.name("v")
+	g.scopes[len(g.scopes)-1] = append(g.scopes[len(g.scopes)-1], name)
+	return &interp.LetStatement{
+		Token: tok(interp.Let, "let"),
+		Name:  ident(name),
+		Value: val,
+	}
+}
+
+func (g *programGenerator) name(prefix string) string {
+	g.counter++
+	return prefix + strconv.Itoa(g.counter)
+}
+
+func (g *programGenerator) visible() []string {
+	var names []string
+	for _, s := range g.scopes {
+		names = append(names, s...)
+	}
+	return names
+}
+
+var (
+	genPrefixOps = []string{"!", "-", "~"}
+	genInfixOps  = []string{"+", "-", "*", "/", "==", "!=", "<", ">", "<=", ">=",
+		"%", "**", "&", "|", "^", "<<", ">>", "&&", "||"}
+	genAssignOps = []string{"+", "-", "*", "/", "%", "**", "&", "|", "^", "<<", ">>"}
+	genStrings   = []string{"", "a", "bc", "異世界"}
+	genBuiltins  = []string{"len", "first", "last", "rest", "push", "compare", "int", "float"}
+)
+
+func (g *programGenerator) expr(depth int) interp.Expression {
+	if depth >= g.maxDepth {
+		return g.leaf()
+	}
+	switch g.rnd.Intn(14) {
+	case 0:
+		op := genPrefixOps[g.rnd.Intn(len(genPrefixOps))]
+		return &interp.PrefixExpression{
+			Token:    tok(interp.Bang, op),
+			Operator: op,
+			Right:    g.expr(depth + 1),
+		}
+	case 1, 2:
+		op := genInfixOps[g.rnd.Intn(len(genInfixOps))]
+		return &interp.InfixExpression{
+			Token:    tok(interp.Plus, op),
+			Operator: op,
+			Left:     g.expr(depth + 1),
+			Right:    g.expr(depth + 1),
+		}
+	case 3:
+		sl := &interp.Slices{Token: tok(interp.Lbracket, "[")}
+		for range g.rnd.Intn(4) {
+			sl.Elements = append(sl.Elements, g.expr(depth+1))
+		}
+		return sl
+	case 4:
+		h := &interp.HashLiteral{Token: tok(interp.Lbrace, "{"), Pairs: map[interp.Expression]interp.Expression{}}
+		// duplicated keys would make the pair kept depend on map order
+		seen := map[string]bool{}
+		for range g.rnd.Intn(3) {
+			k := g.key()
+			if !seen[k.String()] {
+				seen[k.String()] = true
+				h.Pairs[k] = g.expr(depth + 1)
+			}
+		}
+		return h
+	case 5:
+		return &interp.CallIndex{
+			Token: tok(interp.Lbracket, "["),
+			Left:  g.expr(depth + 1),
+			Index: g.expr(depth + 1),
+		}
+	case 6:
+		ie := &interp.IfExpression{
+			Token:     tok(interp.If, "if"),
+			Condition: g.expr(depth + 1),
+			Then:      g.block(depth + 1),
+		}
+		if g.rnd.Intn(2) == 0 {
+			ie.Else = g.block(depth + 1)
+		}
+		return ie
+	case 7:
+		return g.call(depth)
+	case 8:
+		ce := &interp.CallExpression{
+			Token: tok(interp.Lparen, "("),
+			Func:  ident(genBuiltins[g.rnd.Intn(len(genBuiltins))]),
+		}
+		for range 1 + g.rnd.Intn(2) {
+			ce.Args = append(ce.Args, g.expr(depth+1))
+		}
+		return ce
+	case 9:
+		param := g.name("e")
+		return &interp.TryExpression{
+			Token: tok(interp.Try, "try"),
+			Body:  g.block(depth + 1),
+			Param: ident(param),
+			Catch: &interp.BlockStatement{Statements: []interp.Statement{
+				&interp.ExpressionStatement{Expression: &interp.CallIndex{
+					Left:  ident(param),
+					Index: str("kind"),
+				}},
+			}},
+		}
+	case 10:
+		return g.loop(depth)
+	case 11:
+		return g.assign(depth)
+	}
+	return g.leaf()
+}
+
+// call is a function literal called right away, its body may refer to
+// the parameters and the outer names.
+func (g *programGenerator) call(depth int) interp.Expression {
+	fl := &interp.FuncLiteral{Token: tok(interp.Fn, "fn")}
+	g.scopes = append(g.scopes, nil)
+	for range g.rnd.Intn(3) {
+		p := g.name("p")
+		fl.Parameters = append(fl.Parameters, ident(p))
+		g.scopes[len(g.scopes)-1] = append(g.scopes[len(g.scopes)-1], p)
+	}
+	fl.Body = g.block(depth + 1)
+	g.scopes = g.scopes[:len(g.scopes)-1]
+	ce := &interp.CallExpression{Token: tok(interp.Lparen, "("), Func: fl}
+	for range fl.Parameters {
+		ce.Args = append(ce.Args, g.expr(depth+1))
+	}
+	return ce
+}
+
+// assign rebinds a visible name other than a loop counter, which could
+// keep its loop from ending.
+func (g *programGenerator) assign(depth int) interp.Expression {
+	var names []string
+	for _, n := range g.visible() {
+		if !strings.HasPrefix(n, "i") {
+			names = append(names, n)
+		}
+	}
+	if len(names) == 0 {
+		return g.leaf()
+	}
+	op := "="
+	if g.rnd.Intn(2) == 0 {
+		op = genAssignOps[g.rnd.Intn(len(genAssignOps))] + "="
+	}
+	return &interp.AssignExpression{
+		Token:    tok(interp.Assign, op),
+		Name:     ident(names[g.rnd.Intn(len(names))]),
+		Operator: op,
+		Value:    g.expr(depth + 1),
+	}
+}
+
+// loop is a for loop counting up to a small bound, so it always ends.
+// Its body may break or continue before running a block.
+func (g *programGenerator) loop(depth int) interp.Expression {
+	name := g.name("i")
+	scope := len(g.scopes) - 1
+	defined := len(g.scopes[scope])
+	fe := &interp.ForExpression{
+		Token: tok(interp.For, "for"),
+		Init:  &interp.LetStatement{Token: tok(interp.Let, "let"), Name: ident(name), Value: integer(0)},
+		Condition: &interp.InfixExpression{
+			Token:    tok(interp.Lt, "<"),
+			Operator: "<",
+			Left:     ident(name),
+			Right:    integer(g.rnd.Intn(4)),
+		},
+		Post: &interp.LetStatement{Token: tok(interp.Let, "let"), Name: ident(name), Value: &interp.InfixExpression{
+			Token:    tok(interp.Plus, "+"),
+			Operator: "+",
+			Left:     ident(name),
+			Right:    integer(1),
+		}},
+	}
+	g.scopes[scope] = append(g.scopes[scope], name)
+	body := &interp.BlockStatement{Token: tok(interp.Lbrace, "{")}
+	if g.rnd.Intn(2) == 0 {
+		var ctl interp.Statement = &interp.BreakStatement{Token: tok(interp.Break, "break")}
+		if g.rnd.Intn(2) == 0 {
+			ctl = &interp.ContinueStatement{Token: tok(interp.Continue, "continue")}
+		}
+		body.Statements = append(body.Statements, &interp.ExpressionStatement{Expression: &interp.IfExpression{
+			Token:     tok(interp.If, "if"),
+			Condition: g.expr(depth + 1),
+			Then:      &interp.BlockStatement{Token: tok(interp.Lbrace, "{"), Statements: []interp.Statement{ctl}},
+		}})
+	}
+	body.Statements = append(body.Statements, g.block(depth+1).Statements...)
+	fe.Body = body
+	g.scopes[scope] = g.scopes[scope][:defined]
+	return fe
+}
+
+// block holds a few let statements ending with an expression. Its names
+// go out of scope with it in the interpreter, so they are dropped after.
+func (g *programGenerator) block(depth int) *interp.BlockStatement {
+	b := &interp.BlockStatement{Token: tok(interp.Lbrace, "{")}
+	scope := len(g.scopes) - 1
+	defined := len(g.scopes[scope])
+	if len(g.scopes) > 1 {
+		for range g.rnd.Intn(2) {
+			b.Statements = append(b.Statements, g.let(depth))
+		}
+	}
+	b.Statements = append(b.Statements, &interp.ExpressionStatement{Expression: g.expr(depth)})
+	g.scopes[scope] = g.scopes[scope][:defined]
+	return b
+}
+
+func (g *programGenerator) leaf() interp.Expression {
+	names := g.visible()
+	switch n := g.rnd.Intn(6); {
+	case n == 0 && len(names) > 0:
+		return ident(names[g.rnd.Intn(len(names))])
+	case n == 1:
+		return boolean(g.rnd.Intn(2) == 0)
+	case n == 2:
+		return str(genStrings[g.rnd.Intn(len(genStrings))])
+	case n == 3:
+		return float(float64(g.rnd.Intn(9)-2) / 2)
+	}
+	return integer(g.rnd.Intn(12) - 2)
+}
+
+func (g *programGenerator) key() interp.Expression {
+	switch g.rnd.Intn(3) {
+	case 0:
+		return boolean(g.rnd.Intn(2) == 0)
+	case 1:
+		return str(genStrings[g.rnd.Intn(len(genStrings))])
+	}
+	return integer(g.rnd.Intn(5))
+}
+
+func tok(t interp.TokenType, lit string) interp.Token {
+	return interp.Token{Type: t, Literal: lit}
+}
+
+func ident(name string) *interp.Identifier {
+	return &interp.Identifier{Token: tok(interp.Ident, name), Value: name}
+}
+
+func integer(i int) *interp.IntLiteral {
+	return &interp.IntLiteral{Token: tok(interp.Int, strconv.Itoa(i)), Value: i}
+}
+
+func float(f float64) *interp.FloatLiteral {
+	return &interp.FloatLiteral{Token: tok(interp.Flt, strconv.FormatFloat(f, 'g', -1, 64)), Value: f}
+}
+
+func boolean(b bool) *interp.BooleanLiteral {
+	return &interp.BooleanLiteral{Token: tok(interp.True, fmt.Sprint(b)), Value: b}
+}
+
+func str(s string) *interp.StringLiteral {
+	return &interp.StringLiteral{Token: tok(interp.Str, strconv.Quote(s)), Value: s}
+}
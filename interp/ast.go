@@ -2,6 +2,8 @@ package interp
 
 import (
 	"fmt"
+	"math/big"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -103,6 +105,25 @@ func (i *IntLiteral) expressionNode()      {}
 func (i *IntLiteral) TokenLiteral() string { return i.Literal }
 func (i *IntLiteral) String() string       { return i.Literal }
 
+// BigIntLiteral is an integer literal too large for IntLiteral.
+type BigIntLiteral struct {
+	Token
+	Value *big.Int
+}
+
+func (b *BigIntLiteral) expressionNode()      {}
+func (b *BigIntLiteral) TokenLiteral() string { return b.Literal }
+func (b *BigIntLiteral) String() string       { return b.Literal }
+
+type FloatLiteral struct {
+	Token
+	Value float64
+}
+
+func (f *FloatLiteral) expressionNode()      {}
+func (f *FloatLiteral) TokenLiteral() string { return f.Literal }
+func (f *FloatLiteral) String() string       { return f.Literal }
+
 type PrefixExpression struct {
 	Token
 	Operator string
@@ -152,6 +173,72 @@ func (i *IfExpression) String() string {
 	return fmt.Sprintf("if %s %s%s", i.Condition.String(), i.Then.String(), elseLeaf)
 }
 
+type WhileExpression struct {
+	Token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (w *WhileExpression) expressionNode()      {}
+func (w *WhileExpression) TokenLiteral() string { return w.Literal }
+func (w *WhileExpression) String() string {
+	return fmt.Sprintf("while %s %s", w.Condition, w.Body)
+}
+
+// ForExpression is a loop running Init once, then Body and Post as long
+// as Condition holds. Any of Init, Condition and Post may be nil.
+type ForExpression struct {
+	Token
+	Init      Statement
+	Condition Expression
+	Post      Statement
+	Body      *BlockStatement
+}
+
+func (f *ForExpression) expressionNode()      {}
+func (f *ForExpression) TokenLiteral() string { return f.Literal }
+func (f *ForExpression) String() string {
+	clause := func(n Node) string {
+		if n == nil {
+			return ""
+		}
+		return strings.TrimSuffix(n.String(), ";")
+	}
+	return fmt.Sprintf("for (%s; %s; %s) %s",
+		clause(f.Init), clause(f.Condition), clause(f.Post), f.Body)
+}
+
+type BreakStatement struct {
+	Token
+}
+
+func (b *BreakStatement) statementNode()       {}
+func (b *BreakStatement) TokenLiteral() string { return b.Literal }
+func (b *BreakStatement) String() string       { return "break;" }
+
+type ContinueStatement struct {
+	Token
+}
+
+func (c *ContinueStatement) statementNode()       {}
+func (c *ContinueStatement) TokenLiteral() string { return c.Literal }
+func (c *ContinueStatement) String() string       { return "continue;" }
+
+// AssignExpression rebinds Name in the scope defining it. Operator is "="
+// or a compound operator like "+=".
+type AssignExpression struct {
+	Token
+	Name     *Identifier
+	Operator string
+	Value    Expression
+}
+
+func (a *AssignExpression) expressionNode()      {}
+func (a *AssignExpression) TokenLiteral() string { return a.Literal }
+func (a *AssignExpression) String() string {
+	return fmt.Sprintf("(%s%s%s)", a.Name, a.Operator, a.Value)
+}
+
 type BlockStatement struct {
 	Token
 	Statements []Statement
@@ -250,15 +337,60 @@ type HashLiteral struct {
 func (h *HashLiteral) expressionNode()      {}
 func (h *HashLiteral) TokenLiteral() string { return h.Literal }
 func (h *HashLiteral) String() string {
-	bd := make([]string, len(h.Pairs))
-	idx := 0
-	for k, v := range h.Pairs {
-		bd[idx] = fmt.Sprintf("%s:%s", k, v)
-		idx++
+	keys := h.SortedKeys()
+	bd := make([]string, len(keys))
+	for i, k := range keys {
+		bd[i] = fmt.Sprintf("%s:%s", k, h.Pairs[k])
 	}
 	return fmt.Sprintf("{%s}", strings.Join(bd, ","))
 }
 
+// SortedKeys returns the keys of Pairs in source order, then ordered by
+// their source text, so walking a hash literal is deterministic.
+func (h *HashLiteral) SortedKeys() []Expression {
+	keys := make([]Expression, 0, len(h.Pairs))
+	for k := range h.Pairs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		li, ci := position(keys[i])
+		lj, cj := position(keys[j])
+		if li != lj {
+			return li < lj
+		}
+		if ci != cj {
+			return ci < cj
+		}
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
+type positioned interface {
+	Line() int
+	Column() int
+}
+
+func position(e Expression) (line, column int) {
+	if p, ok := e.(positioned); ok {
+		return p.Line(), p.Column()
+	}
+	return 0, 0
+}
+
+type TryExpression struct {
+	Token
+	Body  *BlockStatement
+	Param *Identifier
+	Catch *BlockStatement
+}
+
+func (t *TryExpression) expressionNode()      {}
+func (t *TryExpression) TokenLiteral() string { return t.Literal }
+func (t *TryExpression) String() string {
+	return fmt.Sprintf("try %s catch (%s) %s", t.Body, t.Param, t.Catch)
+}
+
 type ModifierFunc func(Node) Node
 
 func Modify(node Node, modifier ModifierFunc) Node {
@@ -324,6 +456,25 @@ func Modify(node Node, modifier ModifierFunc) Node {
 			}(i, &w)
 		}
 		w.Wait()
+	case *TryExpression:
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+		node.Catch, _ = Modify(node.Catch, modifier).(*BlockStatement)
+	case *WhileExpression:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+	case *ForExpression:
+		if node.Init != nil {
+			node.Init, _ = Modify(node.Init, modifier).(Statement)
+		}
+		if node.Condition != nil {
+			node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		}
+		if node.Post != nil {
+			node.Post, _ = Modify(node.Post, modifier).(Statement)
+		}
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+	case *AssignExpression:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
 	case *ReturnStatement:
 		node.Value, _ = Modify(node.Value, modifier).(Expression)
 	case *LetStatement:
@@ -0,0 +1,184 @@
+package interp
+
+import (
+	"hash/fnv"
+	"math"
+	"math/big"
+)
+
+const BigIntegerType = "BIG_INTEGER"
+
+// BigInteger is an integer outside the range of Integer. It is only made
+// by NewBigInteger, so a value fitting an int is always an Integer.
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (*BigInteger) Type() ObjectType  { return BigIntegerType }
+func (b *BigInteger) Inspect() string { return b.Value.String() }
+
+func (b *BigInteger) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte{byte(b.Value.Sign() + 1)})
+	h.Write(b.Value.Bytes())
+	return HashKey{b.Type(), h.Sum64()}
+}
+
+// MaxBigIntegerBits is the size a BigInteger may grow to, larger results
+// fail with a KindInvalidOperand error instead of exhausting memory.
+const MaxBigIntegerBits = 1 << 20
+
+// NewBigInteger returns v as an Integer when it fits an int or else as a
+// BigInteger.
+func NewBigInteger(v *big.Int) Object {
+	if v.IsInt64() && v.Int64() >= math.MinInt && v.Int64() <= math.MaxInt {
+		return &Integer{Primitive[int]{int(v.Int64())}}
+	}
+	return &BigInteger{v}
+}
+
+// IntOperands returns left and right as big integers when both are
+// integers and at least one of them is a BigInteger.
+func IntOperands(left, right Object) (l, r *big.Int, ok bool) {
+	l, lok := toBigInt(left)
+	r, rok := toBigInt(right)
+	_, lbig := left.(*BigInteger)
+	_, rbig := right.(*BigInteger)
+	return l, r, lok && rok && (lbig || rbig)
+}
+
+func toBigInt(o Object) (*big.Int, bool) {
+	switch n := o.(type) {
+	case *Integer:
+		return big.NewInt(int64(n.Value)), true
+	case *BigInteger:
+		return n.Value, true
+	}
+	return nil, false
+}
+
+func bigToFloat(b *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(b).Float64()
+	return f
+}
+
+// Overflows reports whether op applied to left and right overflows an int.
+// Operations failing otherwise, like a negative shift, do not overflow.
+func Overflows(op string, left, right int) bool {
+	switch op {
+	case "+":
+		return (right > 0 && left > math.MaxInt-right) || (right < 0 && left < math.MinInt-right)
+	case "-":
+		return (right < 0 && left > math.MaxInt+right) || (right > 0 && left < math.MinInt+right)
+	case "*":
+		if left == 0 || right == 0 {
+			return false
+		}
+		if (left == -1 && right == math.MinInt) || (right == -1 && left == math.MinInt) {
+			return true
+		}
+		return left*right/right != left
+	case "/":
+		return left == math.MinInt && right == -1
+	case "**":
+		if right < 0 || left >= -1 && left <= 1 {
+			return false
+		}
+		if right >= 64 {
+			return true
+		}
+		p := 1
+		for range right {
+			if Overflows("*", p, left) {
+				return true
+			}
+			p *= left
+		}
+		return false
+	case "<<":
+		if right < 0 || left == 0 {
+			return false
+		}
+		return right >= 64 || left<<right>>right != left
+	}
+	return false
+}
+
+// BigIntMath applies the integer operator op to left and right and
+// returns the result as NewBigInteger does, or an *Error.
+func BigIntMath(op string, left, right *big.Int) Object {
+	res := new(big.Int)
+	switch op {
+	case "+":
+		res.Add(left, right)
+	case "-":
+		res.Sub(left, right)
+	case "*":
+		res.Mul(left, right)
+	case "/", "%":
+		if right.Sign() == 0 {
+			return newError(KindDivisionByZero, "division by zero: %s %s 0", left, op)
+		}
+		if op == "/" {
+			res.Quo(left, right)
+		} else {
+			res.Rem(left, right)
+		}
+	case "**":
+		if right.Sign() < 0 {
+			return newError(KindInvalidOperand, "negative exponent: %s ** %s", left, right)
+		}
+		if left.CmpAbs(big.NewInt(1)) > 0 &&
+			(!right.IsInt64() || right.Int64() > MaxBigIntegerBits/int64(left.BitLen()-1)) {
+			return tooLarge(op)
+		}
+		res.Exp(left, right, nil)
+	case "&":
+		res.And(left, right)
+	case "|":
+		res.Or(left, right)
+	case "^":
+		res.Xor(left, right)
+	case "<<", ">>":
+		if right.Sign() < 0 {
+			return newError(KindInvalidOperand, "negative shift count: %s %s %s", left, op, right)
+		}
+		if op == ">>" {
+			// shifting out every bit leaves 0 or -1 whatever the count
+			n := uint(left.BitLen() + 1)
+			if right.IsInt64() && right.Int64() < int64(n) {
+				n = uint(right.Int64())
+			}
+			res.Rsh(left, n)
+			break
+		}
+		if left.Sign() != 0 &&
+			(!right.IsInt64() || right.Int64() > int64(MaxBigIntegerBits-left.BitLen())) {
+			return tooLarge(op)
+		}
+		if left.Sign() != 0 {
+			res.Lsh(left, uint(right.Int64()))
+		}
+	default:
+		return newError(KindTypeMismatch, unknownOperatorInfixFmt,
+			NewBigInteger(left).Type(), op, NewBigInteger(right).Type())
+	}
+	if res.BitLen() > MaxBigIntegerBits {
+		return tooLarge(op)
+	}
+	return NewBigInteger(res)
+}
+
+func tooLarge(op string) *Error {
+	return newError(KindInvalidOperand, "integer too large: result of %s exceeds %d bits",
+		op, MaxBigIntegerBits)
+}
+
+// BigIntPrefix applies the prefix operator - or ~ to v and returns the
+// result as NewBigInteger does.
+func BigIntPrefix(op string, v *big.Int) Object {
+	if op == "~" {
+		return NewBigInteger(new(big.Int).Not(v))
+	}
+	return NewBigInteger(new(big.Int).Neg(v))
+}
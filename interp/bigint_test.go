@@ -0,0 +1,79 @@
+package interp
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestOverflows(t *testing.T) {
+	values := []int{0, 1, -1, 2, -2, 3, 62, 63, 64, 1 << 31, -(1 << 31), 1 << 32,
+		math.MaxInt, math.MinInt, math.MaxInt - 1, math.MinInt + 1}
+	for _, op := range []string{"+", "-", "*", "/", "**", "<<"} {
+		for _, l := range values {
+			for _, r := range values {
+				if (op == "/" && r == 0) || ((op == "**" || op == "<<") && r < 0) {
+					continue
+				}
+				res := BigIntMath(op, big.NewInt(int64(l)), big.NewInt(int64(r)))
+				if _, ok := res.(*Error); ok {
+					// too large for a BigInteger, it overflows an int too
+					res = &BigInteger{}
+				}
+				_, big := res.(*BigInteger)
+				if got := Overflows(op, l, r); got != big {
+					t.Errorf("Overflows(%q, %d, %d) = %t, want %t", op, l, r, got, big)
+				}
+			}
+		}
+	}
+}
+
+func TestBigIntMath(t *testing.T) {
+	num := func(s string) *big.Int {
+		b, _ := new(big.Int).SetString(s, 10)
+		return b
+	}
+	tests := []struct {
+		op          string
+		left, right string
+		expected    string
+		kind        ObjectType
+	}{
+		{"+", "9223372036854775807", "1", "9223372036854775808", BigIntegerType},
+		{"-", "9223372036854775808", "1", "9223372036854775807", IntegerType},
+		{"*", "4294967296", "4294967296", "18446744073709551616", BigIntegerType},
+		{"/", "-18446744073709551616", "4294967296", "-4294967296", IntegerType},
+		{"%", "-18446744073709551617", "10", "-7", IntegerType},
+		{"**", "2", "100", "1267650600228229401496703205376", BigIntegerType},
+		{"<<", "1", "64", "18446744073709551616", BigIntegerType},
+		{">>", "-18446744073709551616", "100000000000000000000", "-1", IntegerType},
+		{"&", "18446744073709551615", "255", "255", IntegerType},
+		{"/", "18446744073709551616", "0", "division by zero: 18446744073709551616 / 0", ErrorType},
+		{"**", "2", "-1", "negative exponent: 2 ** -1", ErrorType},
+		{"**", "2", "100000000000", "integer too large: result of ** exceeds 1048576 bits", ErrorType},
+		{"<<", "1", "10000000", "integer too large: result of << exceeds 1048576 bits", ErrorType},
+	}
+	for _, tt := range tests {
+		res := BigIntMath(tt.op, num(tt.left), num(tt.right))
+		got := res.Inspect()
+		if err, ok := res.(*Error); ok {
+			got = err.Msg
+		}
+		if got != tt.expected || res.Type() != tt.kind {
+			t.Errorf("%s %s %s = %s (%s), want %s (%s)",
+				tt.left, tt.op, tt.right, got, res.Type(), tt.expected, tt.kind)
+		}
+	}
+}
+
+func TestBigIntegerHashKey(t *testing.T) {
+	a, _ := new(big.Int).SetString("18446744073709551616", 10)
+	b := new(big.Int).Lsh(big.NewInt(1), 64)
+	if NewBigInteger(a).(Hashable).HashKey() != NewBigInteger(b).(Hashable).HashKey() {
+		t.Errorf("equal big integers have different hash keys")
+	}
+	if NewBigInteger(a).(Hashable).HashKey() == NewBigInteger(new(big.Int).Neg(a)).(Hashable).HashKey() {
+		t.Errorf("opposite big integers have the same hash key")
+	}
+}
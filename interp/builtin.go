@@ -1,15 +1,42 @@
 package interp
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
 	"unicode/utf8"
 )
 
 func wrongArguments(expected, got int) Object {
-	return &Error{fmt.Sprintf("wrong number of arguments. got=%d, want=%d",
-		got, expected)}
+	return newError(KindArity, "wrong number of arguments. got=%d, want=%d",
+		got, expected)
 }
 
+// compareBuiltin returns the compare builtin ordering its arguments with
+// compare.
+func compareBuiltin(compare func(left, right Object) (int, bool)) BuiltinFunction {
+	return func(args ...Object) Object {
+		if len(args) != 2 {
+			return wrongArguments(2, len(args))
+		}
+		c, ok := compare(args[0], args[1])
+		if !ok {
+			return newError(KindTypeMismatch, "arguments to 'compare' not supported, got %s and %s",
+				args[0].Type(), args[1].Type())
+		}
+		if c == Unordered {
+			return newError(KindInvalidOperand, "arguments to 'compare' are unordered, got %s and %s",
+				args[0].Inspect(), args[1].Inspect())
+		}
+		return &Integer{Primitive[int]{c}}
+	}
+}
+
+// CollatedCompare is the compare builtin ordering strings with Collate.
+var CollatedCompare = compareBuiltin(CompareCollated)
+
 var Builtins = map[string]*Builtin{
 	"len": {
 		Fn: func(args ...Object) Object {
@@ -22,8 +49,8 @@ var Builtins = map[string]*Builtin{
 			case *SliceObj:
 				return &Integer{Primitive[int]{len(arg.Elements)}}
 			default:
-				return &Error{fmt.Sprintf("argument to 'len' not supported, got %s",
-					args[0].Type())}
+				return newError(KindTypeMismatch, "argument to 'len' not supported, got %s",
+					args[0].Type())
 			}
 		},
 	},
@@ -49,8 +76,8 @@ var Builtins = map[string]*Builtin{
 				}
 				return arg.Elements[0]
 			default:
-				return &Error{fmt.Sprintf("argument to 'first' not supported, got %s",
-					args[0].Type())}
+				return newError(KindTypeMismatch, "argument to 'first' not supported, got %s",
+					args[0].Type())
 			}
 		},
 	},
@@ -72,8 +99,8 @@ var Builtins = map[string]*Builtin{
 				}
 				return arg.Elements[len(arg.Elements)-1]
 			default:
-				return &Error{fmt.Sprintf("argument to 'last' not supported, got %s",
-					args[len(args)-1].Type())}
+				return newError(KindTypeMismatch, "argument to 'last' not supported, got %s",
+					args[len(args)-1].Type())
 			}
 		},
 	},
@@ -97,11 +124,12 @@ var Builtins = map[string]*Builtin{
 				if length < 1 {
 					return NullObject
 				}
-				arg.Elements = arg.Elements[1:]
-				return arg
+				elms := make([]Object, length-1)
+				copy(elms, arg.Elements[1:])
+				return &SliceObj{Elements: elms}
 			default:
-				return &Error{fmt.Sprintf("argument to 'rest' not supported, got %s",
-					args[len(args)-1].Type())}
+				return newError(KindTypeMismatch, "argument to 'rest' not supported, got %s",
+					args[len(args)-1].Type())
 
 			}
 		},
@@ -115,28 +143,46 @@ var Builtins = map[string]*Builtin{
 			}
 			switch arg := args[0].(type) {
 			case *String:
+				var sb strings.Builder
+				sb.WriteString(arg.Value)
 				for _, s := range args[1:] {
 					switch ss := s.(type) {
 					case *String:
-						arg.Value += ss.Value
+						sb.WriteString(ss.Value)
 					case *Integer:
-						arg.Value += fmt.Sprint(arg.Value)
+						sb.WriteString(fmt.Sprint(ss.Value))
 					case *Boolean:
-						arg.Value += fmt.Sprint(arg.Value)
+						sb.WriteString(fmt.Sprint(ss.Value))
 					default:
-						arg.Value += s.Inspect()
+						sb.WriteString(s.Inspect())
 					}
 				}
-				return arg
+				return &String{Primitive[string]{sb.String()}}
 			case *SliceObj:
-				arg.Elements = append(arg.Elements, args[1:]...)
-				return arg
+				elms := make([]Object, 0, len(arg.Elements)+len(args)-1)
+				elms = append(elms, arg.Elements...)
+				return &SliceObj{Elements: append(elms, args[1:]...)}
 			default:
-				return &Error{fmt.Sprintf("argument to 'push' not supported, got %s",
-					args[0].Type())}
+				return newError(KindTypeMismatch, "argument to 'push' not supported, got %s",
+					args[0].Type())
 			}
 		},
 	},
+	"compare": {
+		Fn: compareBuiltin(Compare),
+	},
+	"throw": {
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return wrongArguments(1, len(args))
+			}
+			msg := args[0].Inspect()
+			if s, ok := args[0].(*String); ok {
+				msg = s.Value
+			}
+			return &Error{Msg: msg, Kind: KindThrown, Value: args[0]}
+		},
+	},
 	"puts": {
 		Fn: func(args ...Object) Object {
 			for _, arg := range args {
@@ -145,4 +191,60 @@ var Builtins = map[string]*Builtin{
 			return NullObject
 		},
 	},
+	"int": {
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return wrongArguments(1, len(args))
+			}
+			switch arg := args[0].(type) {
+			case *Integer, *BigInteger:
+				return arg
+			case *Float:
+				i, ok := floatToInt(arg.Value)
+				if !ok {
+					return newError(KindInvalidOperand, "cannot convert %s to int", arg.Inspect())
+				}
+				return &Integer{Primitive[int]{i}}
+			case *String:
+				s := strings.TrimSpace(arg.Value)
+				i, err := strconv.Atoi(s)
+				if errors.Is(err, strconv.ErrRange) {
+					if b, ok := new(big.Int).SetString(s, 10); ok {
+						return NewBigInteger(b)
+					}
+				}
+				if err != nil {
+					return newError(KindInvalidOperand, "cannot convert %q to int", arg.Value)
+				}
+				return &Integer{Primitive[int]{i}}
+			default:
+				return newError(KindTypeMismatch, "argument to 'int' not supported, got %s",
+					args[0].Type())
+			}
+		},
+	},
+	"float": {
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return wrongArguments(1, len(args))
+			}
+			switch arg := args[0].(type) {
+			case *Integer:
+				return &Float{Primitive[float64]{float64(arg.Value)}}
+			case *BigInteger:
+				return &Float{Primitive[float64]{bigToFloat(arg.Value)}}
+			case *Float:
+				return arg
+			case *String:
+				f, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if err != nil {
+					return newError(KindInvalidOperand, "cannot convert %q to float", arg.Value)
+				}
+				return &Float{Primitive[float64]{f}}
+			default:
+				return newError(KindTypeMismatch, "argument to 'float' not supported, got %s",
+					args[0].Type())
+			}
+		},
+	},
 }
@@ -0,0 +1,120 @@
+package interp
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Compare returns -1, 0, +1 or Unordered for NaN, ordering numbers by value
+// and strings by code point. ok is false for operands of other types.
+func Compare(left, right Object) (c int, ok bool) {
+	return compareWith(left, right, strings.Compare)
+}
+
+// CompareCollated is Compare with strings ordered by Collate.
+func CompareCollated(left, right Object) (c int, ok bool) {
+	return compareWith(left, right, Collate)
+}
+
+// Unordered is the result of Compare for NaN, which is neither less than,
+// equal to nor greater than any number.
+const Unordered = 2
+
+func compareWith(left, right Object, strcmp func(a, b string) int) (int, bool) {
+	if l, r, ok := FloatOperands(left, right); ok {
+		if math.IsNaN(l) || math.IsNaN(r) {
+			return Unordered, true
+		}
+		return cmp.Compare(l, r), true
+	}
+	if l, r, ok := IntOperands(left, right); ok {
+		return l.Cmp(r), true
+	}
+	switch l := left.(type) {
+	case *Integer:
+		if r, ok := right.(*Integer); ok {
+			return cmp.Compare(l.Value, r.Value), true
+		}
+	case *String:
+		if r, ok := right.(*String); ok {
+			return strcmp(l.Value, r.Value), true
+		}
+	}
+	return 0, false
+}
+
+// Collate orders a and b ignoring case and the accents of latinAccents
+// first, then by accent, case and finally code point.
+func Collate(a, b string) int {
+	ka, kb := collationKeys(a), collationKeys(b)
+	for level := range collationLevels {
+		c := slices.CompareFunc(ka, kb, func(x, y collationKey) int {
+			return cmp.Compare(x[level], y[level])
+		})
+		if c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// collationKey holds the weight of a rune at each level: its base letter,
+// its accent and its case.
+type collationKey [collationLevels]rune
+
+const collationLevels = 3
+
+// latinAccents lists the accented forms of each lowercase base letter,
+// an accent weighing its position in the list.
+var latinAccents = map[rune]string{
+	'a': "àáâãäåāăą",
+	'c': "çćĉċč",
+	'd': "ďđ",
+	'e': "èéêëēĕėęě",
+	'g': "ĝğġģ",
+	'h': "ĥħ",
+	'i': "ìíîïĩīĭįı",
+	'j': "ĵ",
+	'k': "ķ",
+	'l': "ĺļľŀł",
+	'n': "ñńņňŉ",
+	'o': "òóôõöøōŏő",
+	'r': "ŕŗř",
+	's': "śŝşš",
+	't': "ţťŧ",
+	'u': "ùúûüũūŭůűų",
+	'w': "ŵ",
+	'y': "ýÿŷ",
+	'z': "źżž",
+}
+
+// latinBase maps an accented lowercase letter to its base letter and
+// accent weight.
+var latinBase = func() map[rune][2]rune {
+	m := map[rune][2]rune{}
+	for base, accented := range latinAccents {
+		for i, r := range []rune(accented) {
+			m[r] = [2]rune{base, rune(i + 1)}
+		}
+	}
+	return m
+}()
+
+func collationKeys(s string) []collationKey {
+	keys := make([]collationKey, 0, len(s))
+	for _, r := range s {
+		lower := unicode.ToLower(r)
+		k := collationKey{lower, 0, 0}
+		if b, ok := latinBase[lower]; ok {
+			k[0], k[1] = b[0], b[1]
+		}
+		if lower != r {
+			k[2] = 1
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,63 @@
+package interp
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	str := func(s string) Object { return &String{Primitive[string]{s}} }
+	num := func(i int) Object { return &Integer{Primitive[int]{i}} }
+	nan := &Float{Primitive[float64]{math.NaN()}}
+	tests := []struct {
+		left, right Object
+		expected    int
+		ok          bool
+	}{
+		{num(1), num(2), -1, true},
+		{num(2), num(2), 0, true},
+		{str("b"), str("a"), 1, true},
+		{str("a"), str("ab"), -1, true},
+		{str("Z"), str("a"), -1, true},
+		{str("a"), num(1), 0, false},
+		{TrueObject, FalseObject, 0, false},
+		{nan, num(1), Unordered, true},
+		{nan, nan, Unordered, true},
+	}
+	for _, tt := range tests {
+		c, ok := Compare(tt.left, tt.right)
+		if c != tt.expected || ok != tt.ok {
+			t.Errorf("Compare(%s, %s) = %d, %t, want %d, %t",
+				tt.left.Inspect(), tt.right.Inspect(), c, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestCollate(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"a", "b", -1},
+		{"Z", "a", 1},
+		{"a", "A", -1},
+		{"B", "a", 1},
+		{"é", "f", -1},
+		{"e", "é", -1},
+		{"é", "É", -1},
+		{"resume", "résumé", -1},
+		{"Résumé", "resumes", -1},
+		{"Ça", "cb", -1},
+		{"straße", "strasse", 1},
+		{"異世界", "異世界", 0},
+		{"", "a", -1},
+	}
+	for _, tt := range tests {
+		if c := Collate(tt.a, tt.b); c != tt.expected {
+			t.Errorf("Collate(%q, %q) = %d, want %d", tt.a, tt.b, c, tt.expected)
+		}
+		if c := Collate(tt.b, tt.a); c != -tt.expected {
+			t.Errorf("Collate(%q, %q) = %d, want %d", tt.b, tt.a, c, -tt.expected)
+		}
+	}
+}
@@ -1,16 +1,38 @@
 package interp
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store    map[string]Object
+	outer    *Environment
+	builtins map[string]*Builtin
 }
 
 func NewEnvironment() *Environment {
-	return &Environment{map[string]Object{}, nil}
+	return &Environment{store: map[string]Object{}}
 }
 
 func NewEnvironmentFrame(parent *Environment) *Environment {
-	return &Environment{map[string]Object{}, parent}
+	return &Environment{store: map[string]Object{}, outer: parent}
+}
+
+// RegisterBuiltin makes fn callable as name in e and its frames, over the
+// global Builtins.
+func (e *Environment) RegisterBuiltin(name string, fn BuiltinFunction) {
+	if e.builtins == nil {
+		e.builtins = map[string]*Builtin{}
+	}
+	e.builtins[name] = &Builtin{Fn: fn}
+}
+
+// Builtin looks up name in the builtins registered on e and its outer
+// environments, then in the global Builtins.
+func (e *Environment) Builtin(name string) (*Builtin, bool) {
+	for env := e; env != nil; env = env.outer {
+		if b, ok := env.builtins[name]; ok {
+			return b, true
+		}
+	}
+	b, ok := Builtins[name]
+	return b, ok
 }
 
 func (e Environment) Get(name string) (Object, bool) {
@@ -26,3 +48,15 @@ func (e Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// Assign rebinds name in the environment defining it, e or one of its
+// outer environments. It reports false when name is not defined.
+func (e *Environment) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = val
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,10 @@ package interp
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
 )
 
 var (
@@ -15,14 +19,109 @@ const (
 	unknownOperatorInfixFmt  = "unknown operator: %s %s %s"
 )
 
+func newError(kind ErrorKind, format string, a ...any) *Error {
+	return &Error{Msg: fmt.Sprintf(format, a...), Kind: kind}
+}
+
+// EvalOptions bounds the work done by EvalWithOptions.
+type EvalOptions struct {
+	// Collate orders strings with Collate, except in the compare builtin,
+	// see CollatedCompare. Unset, strings are ordered bytewise.
+	Collate bool
+
+	// BigInt promotes the result of integer arithmetic overflowing an int
+	// to a BigInteger. Unset, it wraps around.
+	BigInt bool
+
+	// MaxSteps is the number of nodes that may be evaluated. Zero means
+	// no limit.
+	MaxSteps int
+	// MaxDepth is how deep evaluation may nest, counting both nested
+	// expressions and function calls. Zero means no limit.
+	MaxDepth int
+	// MaxFrames is how deep function calls may nest before failing with
+	// a KindStackOverflow error. Zero means DefaultMaxFrames.
+	MaxFrames int
+}
+
+// DefaultMaxFrames is the call depth allowed when EvalOptions.MaxFrames is
+// not set.
+const DefaultMaxFrames = 1024
+
+const mainName = "<main>"
+
+type evaluator struct {
+	opts  EvalOptions
+	steps int
+	depth int
+	// frames are the active calls, the last one being the innermost.
+	frames []TraceFrame
+}
+
+// Eval evaluates node in env. A Go panic, e.g. in a builtin, is returned
+// as an internal error object.
 func Eval(node Node, env *Environment) Object {
+	return EvalWithOptions(node, env, EvalOptions{})
+}
+
+// EvalWithOptions is Eval within the limits of opts. Exceeding a limit
+// returns a KindBudgetExceeded error which try blocks cannot catch.
+func EvalWithOptions(node Node, env *Environment, opts EvalOptions) (obj Object) {
+	defer recoverPanic(&obj)
+	return newEvaluator(opts).eval(node, env)
+}
+
+// Apply calls fn, a function or a builtin, with args and returns the
+// result.
+func Apply(fn Object, args ...Object) Object {
+	return ApplyWithOptions(fn, EvalOptions{}, args...)
+}
+
+// ApplyWithOptions is Apply within the limits of opts.
+func ApplyWithOptions(fn Object, opts EvalOptions, args ...Object) (obj Object) {
+	defer recoverPanic(&obj)
+	return newEvaluator(opts).evalCall(fn, args)
+}
+
+func newEvaluator(opts EvalOptions) *evaluator {
+	if opts.MaxFrames == 0 {
+		opts.MaxFrames = DefaultMaxFrames
+	}
+	return &evaluator{opts: opts, frames: []TraceFrame{{Function: mainName}}}
+}
+
+func recoverPanic(obj *Object) {
+	if r := recover(); r != nil {
+		*obj = newError(KindInternal, "internal error: %v", r)
+	}
+}
+
+func (ev *evaluator) eval(node Node, env *Environment) Object {
+	ev.steps++
+	if ev.opts.MaxSteps > 0 && ev.steps > ev.opts.MaxSteps {
+		return newError(KindBudgetExceeded, "step limit exceeded: %d", ev.opts.MaxSteps)
+	}
+	if ev.opts.MaxDepth > 0 && ev.depth >= ev.opts.MaxDepth {
+		return newError(KindBudgetExceeded, "depth limit exceeded: %d", ev.opts.MaxDepth)
+	}
+	ev.depth++
+	obj := ev.evalNode(node, env)
+	ev.depth--
+	return obj
+}
+
+func (ev *evaluator) evalNode(node Node, env *Environment) Object {
 	switch n := node.(type) {
 	case *Program:
-		return evalProgram(n.Statements, env)
+		return ev.evalProgram(n.Statements, env)
 	case *ExpressionStatement:
-		return Eval(n.Expression, env)
+		return ev.eval(n.Expression, env)
 	case *IntLiteral:
 		return &Integer{Primitive[int]{n.Value}}
+	case *BigIntLiteral:
+		return NewBigInteger(n.Value)
+	case *FloatLiteral:
+		return &Float{Primitive[float64]{n.Value}}
 	case *StringLiteral:
 		return &String{Primitive[string]{n.Value}}
 	case *BooleanLiteral:
@@ -31,77 +130,98 @@ func Eval(node Node, env *Environment) Object {
 		}
 		return FalseObject
 	case *PrefixExpression:
-		right := Eval(n.Right, env)
+		right := ev.eval(n.Right, env)
 		if _, yes := right.(*Error); yes {
 			return right
 		}
-		return evalPrefix(n.Operator, right)
+		return ev.evalPrefix(n.Operator, right)
 	case *InfixExpression:
-		left := Eval(n.Left, env)
+		if n.Operator == "&&" || n.Operator == "||" {
+			return ev.evalLogical(n, env)
+		}
+		left := ev.eval(n.Left, env)
 		if _, yes := left.(*Error); yes {
 			return left
 		}
-		right := Eval(n.Right, env)
+		right := ev.eval(n.Right, env)
 		if _, yes := right.(*Error); yes {
 			return right
 		}
-		return evalInfix(n.Operator, left, right)
+		return ev.evalInfix(n.Operator, left, right)
 	case *BlockStatement:
-		return evalBlockStatements(n.Statements, env)
+		return ev.evalBlockStatements(n.Statements, env)
 	case *IfExpression:
-		return evalIfElse(n, env)
+		return ev.evalIfElse(n, env)
+	case *WhileExpression:
+		return ev.evalLoop(nil, n.Condition, nil, n.Body, env)
+	case *ForExpression:
+		return ev.evalLoop(n.Init, n.Condition, n.Post, n.Body, env)
+	case *BreakStatement:
+		return &LoopControl{Break: true}
+	case *ContinueStatement:
+		return &LoopControl{Break: false}
 	case *ReturnStatement:
-		val := Eval(n.Value, env)
+		val := ev.eval(n.Value, env)
 		if _, yes := val.(*Error); yes {
 			return val
 		}
 		return &ReturnValue{Primitive[Object]{val}}
 	case *LetStatement:
-		val := Eval(n.Value, env)
+		val := ev.eval(n.Value, env)
 		if _, yes := val.(*Error); yes {
 			return val
 		}
 		env.Set(n.Name.Value, val)
+	case *AssignExpression:
+		return ev.evalAssign(n, env)
 	case *Identifier:
 		return evalIdentifier(n, env)
 	case *FuncLiteral:
 		params := n.Parameters
 		body := n.Body
-		return &Function{Parameters: params, Env: env, Body: body}
+		return &Function{Name: n.Name, Parameters: params, Env: env, Body: body}
 	case *CallExpression:
 		if n.Func.String() == "quote" {
-			nn := evalUnquoteCalls(n.Args[0], env)
+			nn := ev.evalUnquoteCalls(n.Args[0], env)
 			return &Quote{nn}
 		}
-		fn := Eval(n.Func, env)
+		fn := ev.eval(n.Func, env)
 		if _, yes := fn.(*Error); yes {
 			return fn
 		}
-		args := evalExpression(n.Args, env)
+		args := ev.evalExpression(n.Args, env)
 		if len(args) == 1 {
 			if _, yes := args[0].(*Error); yes {
 				return args[0]
 			}
 		}
-		return evalCall(fn, args)
+		caller := &ev.frames[len(ev.frames)-1]
+		caller.Line, caller.Column = n.Line(), n.Column()
+		return ev.evalCall(fn, args)
 	case *Slices:
 		sl := &SliceObj{make([]Object, len(n.Elements))}
 		for i, e := range n.Elements {
-			sl.Elements[i] = Eval(e, env)
+			elm := ev.eval(e, env)
+			if _, yes := elm.(*Error); yes {
+				return elm
+			}
+			sl.Elements[i] = elm
 		}
 		return sl
 	case *CallIndex:
-		return evalSliceIndex(n, env)
+		return ev.evalSliceIndex(n, env)
 	case *HashLiteral:
-		return evalHash(n, env)
+		return ev.evalHash(n, env)
+	case *TryExpression:
+		return ev.evalTry(n, env)
 	}
 	return nil
 }
 
-func evalProgram(stmt []Statement, env *Environment) Object {
+func (ev *evaluator) evalProgram(stmt []Statement, env *Environment) Object {
 	var o Object
 	for _, s := range stmt {
-		o = Eval(s, env)
+		o = ev.eval(s, env)
 		switch r := o.(type) {
 		case *ReturnValue:
 			return r.Value
@@ -112,13 +232,13 @@ func evalProgram(stmt []Statement, env *Environment) Object {
 	return o
 }
 
-func evalBlockStatements(stmt []Statement, env *Environment) Object {
+func (ev *evaluator) evalBlockStatements(stmt []Statement, env *Environment) Object {
 	var o Object
 	for _, s := range stmt {
-		o = Eval(s, env)
+		o = ev.eval(s, env)
 		if o != nil {
 			rt := o.Type()
-			if rt == RetType || rt == ErrorType {
+			if rt == RetType || rt == ErrorType || rt == LoopType {
 				return o
 			}
 		}
@@ -126,163 +246,343 @@ func evalBlockStatements(stmt []Statement, env *Environment) Object {
 	return o
 }
 
-func evalPrefix(op string, o Object) Object {
+func (ev *evaluator) evalPrefix(op string, o Object) Object {
 	switch op {
 	case "!":
-		switch o {
-		case TrueObject:
-			return FalseObject
-		case FalseObject:
-			return TrueObject
-		case NullObject:
-			return TrueObject
-		default:
+		if IsTruthy(o) {
 			return FalseObject
 		}
+		return TrueObject
 	case "-":
-		i, ok := o.(*Integer)
-		if !ok {
-			return &Error{fmt.Sprintf(unknownOperatorPrefixFmt, op, o.Type())}
-		}
-		i.Value *= -1
-		return i
+		switch n := o.(type) {
+		case *Integer:
+			if ev.opts.BigInt && n.Value == math.MinInt {
+				return BigIntPrefix(op, big.NewInt(int64(n.Value)))
+			}
+			return &Integer{Primitive[int]{-n.Value}}
+		case *BigInteger:
+			return BigIntPrefix(op, n.Value)
+		case *Float:
+			return &Float{Primitive[float64]{-n.Value}}
+		}
+		return newError(KindTypeMismatch, unknownOperatorPrefixFmt, op, o.Type())
+	case "~":
+		switch n := o.(type) {
+		case *Integer:
+			return &Integer{Primitive[int]{^n.Value}}
+		case *BigInteger:
+			return BigIntPrefix(op, n.Value)
+		}
+		return newError(KindTypeMismatch, unknownOperatorPrefixFmt, op, o.Type())
 	default:
-		return &Error{fmt.Sprintf(unknownOperatorPrefixFmt, op, o.Type())}
+		return newError(KindTypeMismatch, unknownOperatorPrefixFmt, op, o.Type())
 	}
 }
 
+// evalInfixMath returns a new integer, the operands may be bound to names.
 func evalInfixMath(op string, left, right *Integer) Object {
 	switch op {
 	case "+":
-		left.Value += right.Value
-		return left
+		return &Integer{Primitive[int]{left.Value + right.Value}}
 	case "-":
-		left.Value -= right.Value
-		return left
+		return &Integer{Primitive[int]{left.Value - right.Value}}
 	case "*":
-		left.Value *= right.Value
-		return left
+		return &Integer{Primitive[int]{left.Value * right.Value}}
 	case "/":
-		left.Value /= right.Value
-		return left
+		if right.Value == 0 {
+			return newError(KindDivisionByZero, "division by zero: %d / 0", left.Value)
+		}
+		return &Integer{Primitive[int]{left.Value / right.Value}}
+	case "%":
+		if right.Value == 0 {
+			return newError(KindDivisionByZero, "division by zero: %d %% 0", left.Value)
+		}
+		return &Integer{Primitive[int]{left.Value % right.Value}}
+	case "**":
+		if right.Value < 0 {
+			return newError(KindInvalidOperand, "negative exponent: %d ** %d", left.Value, right.Value)
+		}
+		return &Integer{Primitive[int]{IntPow(left.Value, right.Value)}}
+	case "&":
+		return &Integer{Primitive[int]{left.Value & right.Value}}
+	case "|":
+		return &Integer{Primitive[int]{left.Value | right.Value}}
+	case "^":
+		return &Integer{Primitive[int]{left.Value ^ right.Value}}
+	case "<<", ">>":
+		if right.Value < 0 {
+			return newError(KindInvalidOperand, "negative shift count: %d %s %d", left.Value, op, right.Value)
+		}
+		if op == "<<" {
+			return &Integer{Primitive[int]{left.Value << right.Value}}
+		}
+		return &Integer{Primitive[int]{left.Value >> right.Value}}
+	default:
+		return newError(KindTypeMismatch, unknownOperatorInfixFmt,
+			left.Type(), op, right.Type())
+	}
+}
+
+// evalIntegerMath is evalInfixMath promoting the result to a BigInteger
+// when it overflows and EvalOptions.BigInt is set.
+func (ev *evaluator) evalIntegerMath(op string, left, right *Integer) Object {
+	if ev.opts.BigInt && Overflows(op, left.Value, right.Value) {
+		return BigIntMath(op, big.NewInt(int64(left.Value)), big.NewInt(int64(right.Value)))
+	}
+	return evalInfixMath(op, left, right)
+}
+
+// evalFloatMath is evalInfixMath for operands of which one at least is a
+// float, the other being promoted.
+func evalFloatMath(op string, left, right float64) Object {
+	switch op {
+	case "+":
+		return &Float{Primitive[float64]{left + right}}
+	case "-":
+		return &Float{Primitive[float64]{left - right}}
+	case "*":
+		return &Float{Primitive[float64]{left * right}}
+	case "/":
+		if right == 0 {
+			return newError(KindDivisionByZero, "division by zero: %s / %s", formatFloat(left), formatFloat(right))
+		}
+		return &Float{Primitive[float64]{left / right}}
+	case "%":
+		if right == 0 {
+			return newError(KindDivisionByZero, "division by zero: %s %% %s", formatFloat(left), formatFloat(right))
+		}
+		return &Float{Primitive[float64]{math.Mod(left, right)}}
+	case "**":
+		return &Float{Primitive[float64]{math.Pow(left, right)}}
 	default:
-		return &Error{fmt.Sprintf(unknownOperatorInfixFmt,
-			left.Type(), op, right.Type())}
+		return newError(KindTypeMismatch, unknownOperatorInfixFmt, FloatType, op, FloatType)
 	}
 }
 
-func evalInfix(op string, left, right Object) Object {
+func (ev *evaluator) evalInfix(op string, left, right Object) Object {
 	lint, lok := left.(*Integer)
 	rint, rok := right.(*Integer)
 	switch op {
-	case "-", "*", "/":
+	case "-", "*", "/", "%", "**":
+		if l, r, ok := FloatOperands(left, right); ok {
+			return evalFloatMath(op, l, r)
+		}
+		fallthrough
+	case "&", "|", "^", "<<", ">>":
+		if l, r, ok := IntOperands(left, right); ok {
+			return BigIntMath(op, l, r)
+		}
 		if !lok || !rok {
-			return &Error{fmt.Sprintf(unknownOperatorInfixFmt,
-				left.Type(), op, right.Type())}
+			return newError(KindTypeMismatch, unknownOperatorInfixFmt,
+				left.Type(), op, right.Type())
 		}
-		return evalInfixMath(op, lint, rint)
+		return ev.evalIntegerMath(op, lint, rint)
 	case "+":
 		if lok && rok {
-			lint.Value += rint.Value
-			return lint
+			return ev.evalIntegerMath(op, lint, rint)
+		}
+		if l, r, ok := FloatOperands(left, right); ok {
+			return evalFloatMath(op, l, r)
+		}
+		if l, r, ok := IntOperands(left, right); ok {
+			return BigIntMath(op, l, r)
+		}
+		if lsl, ok := left.(*SliceObj); ok {
+			if rsl, ok := right.(*SliceObj); ok {
+				elms := make([]Object, 0, len(lsl.Elements)+len(rsl.Elements))
+				elms = append(append(elms, lsl.Elements...), rsl.Elements...)
+				return &SliceObj{elms}
+			}
 		}
 		lstr, lok := left.(*String)
 		rstr, rok := right.(*String)
 		if !lok || !rok {
-			return &Error{fmt.Sprintf(unknownOperatorInfixFmt,
-				left.Type(), op, right.Type())}
+			return newError(KindTypeMismatch, unknownOperatorInfixFmt,
+				left.Type(), op, right.Type())
 		}
-		lstr.Value += rstr.Value
-		return lstr
+		return &String{Primitive[string]{lstr.Value + rstr.Value}}
 	case "<=", ">=", ">", "<":
-		if !lok || !rok {
-			return NullObject
+		compare := Compare
+		if ev.opts.Collate {
+			compare = CompareCollated
 		}
-		return evalCompareInt(op, lint, rint)
-	case "==", "!=":
-		if lok && rok {
-			if op == "==" {
-				if lint.Value == rint.Value {
-					return TrueObject
-				}
-				return FalseObject
-			}
-			if lint.Value != rint.Value {
-				return TrueObject
-			}
-			return FalseObject
-		}
-		b := toNativeBoolean(left) == toNativeBoolean(right)
-		if (op == "==" && b) || (op == "!=" && !b) {
-			return TrueObject
-		}
-		return FalseObject
+		c, ok := compare(left, right)
+		if !ok {
+			return newError(KindTypeMismatch, unknownOperatorInfixFmt,
+				left.Type(), op, right.Type())
+		}
+		return evalOrdering(op, c)
+	case "==":
+		return nativeBoolToObject(Equal(left, right))
+	case "!=":
+		return nativeBoolToObject(!Equal(left, right))
 	default:
-		return &Error{fmt.Sprintf(unknownOperatorInfixFmt, left.Type(), op, right.Type())}
+		return newError(KindTypeMismatch, unknownOperatorInfixFmt, left.Type(), op, right.Type())
 	}
 }
 
-func evalCompareInt(op string, left, right *Integer) Object {
-	compare := func(test bool) Object {
-		if test {
-			return TrueObject
-		}
+// evalLogical evaluates && and || to a boolean, the right operand only
+// when the left one does not decide the result.
+func (ev *evaluator) evalLogical(n *InfixExpression, env *Environment) Object {
+	left := ev.eval(n.Left, env)
+	if _, yes := left.(*Error); yes {
+		return left
+	}
+	if IsTruthy(left) == (n.Operator == "||") {
+		return nativeBoolToObject(IsTruthy(left))
+	}
+	right := ev.eval(n.Right, env)
+	if _, yes := right.(*Error); yes {
+		return right
+	}
+	return nativeBoolToObject(IsTruthy(right))
+}
+
+// IntPow returns base raised to exp, which must not be negative. Like the
+// other integer operators it wraps around on overflow.
+func IntPow(base, exp int) int {
+	res := 1
+	for exp > 0 {
+		if exp&1 == 1 {
+			res *= base
+		}
+		base *= base
+		exp >>= 1
+	}
+	return res
+}
+
+// evalOrdering applies op to c, the result of Compare.
+func evalOrdering(op string, c int) Object {
+	if c == Unordered {
 		return FalseObject
 	}
 	switch op {
 	case ">":
-		return compare(left.Value > right.Value)
+		return nativeBoolToObject(c > 0)
 	case ">=":
-		return compare(left.Value >= right.Value)
+		return nativeBoolToObject(c >= 0)
 	case "<":
-		return compare(left.Value < right.Value)
+		return nativeBoolToObject(c < 0)
 	case "<=":
-		return compare(left.Value <= right.Value)
+		return nativeBoolToObject(c <= 0)
 	default:
 		return NullObject
 	}
 }
 
-func toNativeBoolean(o Object) bool {
-	switch vo := o.(type) {
-	case *Integer:
-		return vo.Value != 0
-	case *Null:
-		return false
-	case *Boolean:
-		return vo.Value
-	default:
-		return false
+func nativeBoolToObject(b bool) Object {
+	if b {
+		return TrueObject
 	}
+	return FalseObject
 }
 
-func evalIfElse(ie *IfExpression, env *Environment) Object {
-	cond := Eval(ie.Condition, env)
+func (ev *evaluator) evalIfElse(ie *IfExpression, env *Environment) Object {
+	cond := ev.eval(ie.Condition, env)
 	if _, yes := cond.(*Error); yes {
 		return cond
 	}
-	if toNativeBoolean(cond) {
-		return Eval(ie.Then, env)
+	if IsTruthy(cond) {
+		return ev.eval(ie.Then, env)
 	} else if ie.Else != nil {
-		return Eval(ie.Else, env)
+		return ev.eval(ie.Else, env)
 	}
 	return NullObject
 }
 
+// evalLoop runs init, then body and post while cond holds, a nil cond
+// always holding. The loop evaluates to null.
+func (ev *evaluator) evalLoop(init Statement, cond Expression, post Statement,
+	body *BlockStatement, env *Environment) Object {
+	if init != nil {
+		if res, ok := ev.eval(init, env).(*Error); ok {
+			return res
+		}
+	}
+	for {
+		if cond != nil {
+			c := ev.eval(cond, env)
+			if _, yes := c.(*Error); yes {
+				return c
+			}
+			if !IsTruthy(c) {
+				break
+			}
+		}
+		res := ev.eval(body, env)
+		if ctl, ok := res.(*LoopControl); ok {
+			if ctl.Break {
+				break
+			}
+		} else if res != nil && (res.Type() == RetType || res.Type() == ErrorType) {
+			return res
+		}
+		if post != nil {
+			if res, ok := ev.eval(post, env).(*Error); ok {
+				return res
+			}
+		}
+	}
+	return NullObject
+}
+
+func (ev *evaluator) evalTry(te *TryExpression, env *Environment) Object {
+	res := ev.eval(te.Body, env)
+	err, ok := res.(*Error)
+	if ok && !err.Kind.Catchable() {
+		return err
+	}
+	if !ok {
+		if res == nil {
+			return NullObject
+		}
+		return res
+	}
+	frame := NewEnvironmentFrame(env)
+	frame.Set(te.Param.Value, err.ToHash())
+	res = ev.eval(te.Catch, frame)
+	if res == nil {
+		return NullObject
+	}
+	return res
+}
+
+// evalAssign rebinds the name of ae where it is defined. A compound
+// assignment reads the current value before evaluating the new one.
+func (ev *evaluator) evalAssign(ae *AssignExpression, env *Environment) Object {
+	cur, ok := env.Get(ae.Name.Value)
+	if !ok {
+		return newError(KindUndefined, "identifier not found: %s", ae.Name.Value)
+	}
+	val := ev.eval(ae.Value, env)
+	if _, yes := val.(*Error); yes {
+		return val
+	}
+	if op := strings.TrimSuffix(ae.Operator, "="); op != "" {
+		val = ev.evalInfix(op, cur, val)
+		if _, yes := val.(*Error); yes {
+			return val
+		}
+	}
+	env.Assign(ae.Name.Value, val)
+	return val
+}
+
 func evalIdentifier(o *Identifier, env *Environment) Object {
 	if val, ok := env.Get(o.Value); ok {
 		return val
 	}
-	if bltn, ok := Builtins[o.Value]; ok {
+	if bltn, ok := env.Builtin(o.Value); ok {
 		return bltn
 	}
-	return &Error{fmt.Sprintf("identifier not found: %s", o.Value)}
+	return newError(KindUndefined, "identifier not found: %s", o.Value)
 }
 
-func evalExpression(exps []Expression, env *Environment) []Object {
+func (ev *evaluator) evalExpression(exps []Expression, env *Environment) []Object {
 	res := make([]Object, len(exps))
 	for i, e := range exps {
-		evl := Eval(e, env)
+		evl := ev.eval(e, env)
 		if _, yes := evl.(*Error); yes {
 			return []Object{evl}
 		}
@@ -291,14 +591,30 @@ func evalExpression(exps []Expression, env *Environment) []Object {
 	return res
 }
 
-func evalCall(fn Object, args []Object) Object {
+func (ev *evaluator) evalCall(fn Object, args []Object) Object {
 	switch ffn := fn.(type) {
 	case *Function:
+		if len(args) != len(ffn.Parameters) {
+			return newError(KindArity, "wrong argument number: want=%d, got=%d",
+				len(ffn.Parameters), len(args))
+		}
+		if len(ev.frames) >= ev.opts.MaxFrames {
+			err := newError(KindStackOverflow,
+				"stack overflow: maximum call depth %d exceeded", ev.opts.MaxFrames)
+			err.Trace = ev.trace()
+			return err
+		}
+		name := ffn.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		ev.frames = append(ev.frames, TraceFrame{Function: name})
+		defer func() { ev.frames = ev.frames[:len(ev.frames)-1] }()
 		envFrame := NewEnvironmentFrame(ffn.Env)
 		for i, a := range ffn.Parameters {
 			envFrame.Set(a.Value, args[i])
 		}
-		evl := Eval(ffn.Body, envFrame)
+		evl := ev.eval(ffn.Body, envFrame)
 		if val, ok := evl.(*ReturnValue); ok {
 			return val.Value
 		}
@@ -306,23 +622,32 @@ func evalCall(fn Object, args []Object) Object {
 	case *Builtin:
 		return ffn.Fn(args...)
 	}
-	return &Error{fmt.Sprintf("not a function: %s", fn.Type())}
+	return newError(KindTypeMismatch, "not a function: %s", fn.Type())
 }
 
-func evalSliceIndex(n *CallIndex, env *Environment) Object {
-	left := Eval(n.Left, env)
+// trace returns the active calls innermost first.
+func (ev *evaluator) trace() []TraceFrame {
+	trace := make([]TraceFrame, len(ev.frames))
+	for i, f := range ev.frames {
+		trace[len(trace)-1-i] = f
+	}
+	return trace
+}
+
+func (ev *evaluator) evalSliceIndex(n *CallIndex, env *Environment) Object {
+	left := ev.eval(n.Left, env)
 	if _, yes := left.(*Error); yes {
 		return left
 	}
-	idx := Eval(n.Index, env)
+	idx := ev.eval(n.Index, env)
 	if _, yes := idx.(*Error); yes {
 		return idx
 	}
 	checkIfIdxInt := func(idx Object) (*Integer, bool, Object) {
 		i, ok := idx.(*Integer)
 		if !ok {
-			err := &Error{fmt.Sprintf("wrong index, expected %s got=%T (%+v)",
-				IntegerType, idx, idx)}
+			err := newError(KindTypeMismatch, "wrong index, expected %s got=%T (%+v)",
+				IntegerType, idx, idx)
 			return nil, false, err
 		}
 		if i.Value < 0 {
@@ -345,15 +670,19 @@ func evalSliceIndex(n *CallIndex, env *Environment) Object {
 		if !ok && errOrNull != nil {
 			return errOrNull
 		}
-		for idx, r := range slc.Value {
-			if idx == i.Value {
+		// strings are indexed by rune like in the vm
+		count := 0
+		for _, r := range slc.Value {
+			if count == i.Value {
 				return &String{Primitive[string]{string(r)}}
 			}
+			count++
 		}
+		return NullObject
 	case *Hash:
 		hk, ok := idx.(Hashable)
 		if !ok {
-			return &Error{fmt.Sprintf("unknown as hash key: %s", idx.Type())}
+			return newError(KindUnhashableKey, "unknown as hash key: %s", idx.Type())
 		}
 		hv, ok := slc.Pairs[hk.HashKey()]
 		if !ok {
@@ -361,22 +690,24 @@ func evalSliceIndex(n *CallIndex, env *Environment) Object {
 		}
 		return hv.Value
 	}
-	return &Error{fmt.Sprintf("wrong type, expected %s got=%T (%+v)",
-		SliceType, left, left)}
+	return newError(KindTypeMismatch, "wrong type, expected %s got=%T (%+v)",
+		SliceType, left, left)
 }
 
-func evalHash(n *HashLiteral, env *Environment) Object {
+func (ev *evaluator) evalHash(n *HashLiteral, env *Environment) Object {
 	h := &Hash{map[HashKey]HashPair{}}
-	for k, v := range n.Pairs {
-		kk := Eval(k, env)
+	// same order as the compiler so both engines fail on the same pair
+	for _, k := range n.SortedKeys() {
+		v := n.Pairs[k]
+		kk := ev.eval(k, env)
 		if _, yes := kk.(*Error); yes {
 			return kk
 		}
 		hk, ok := kk.(Hashable)
 		if !ok {
-			return &Error{fmt.Sprintf("unusable as hash key: %s", kk.Type())}
+			return newError(KindUnhashableKey, "unusable as hash key: %s", kk.Type())
 		}
-		vv := Eval(v, env)
+		vv := ev.eval(v, env)
 		if _, yes := vv.(*Error); yes {
 			return vv
 		}
@@ -385,7 +716,9 @@ func evalHash(n *HashLiteral, env *Environment) Object {
 	return h
 }
 
-func evalUnquoteCalls(n Node, env *Environment) Node {
+func (ev *evaluator) evalUnquoteCalls(n Node, env *Environment) Node {
+	// Modify runs the modifier on siblings concurrently, ev counts steps
+	var mu sync.Mutex
 	return Modify(n, func(node Node) Node {
 		ce, ok := node.(*CallExpression)
 		if !ok || ce.Func.String() != "unquote" {
@@ -394,7 +727,9 @@ func evalUnquoteCalls(n Node, env *Environment) Node {
 		if len(ce.Args) != 1 {
 			return node
 		}
-		unquoted := Eval(ce.Args[0], env)
+		mu.Lock()
+		defer mu.Unlock()
+		unquoted := ev.eval(ce.Args[0], env)
 		return objectToAst(unquoted)
 	})
 }
@@ -407,6 +742,18 @@ func objectToAst(object Object) Node {
 			Literal: fmt.Sprint(o.Value),
 		}
 		return &IntLiteral{Token: t, Value: o.Value}
+	case *BigInteger:
+		t := Token{
+			Type:    Int,
+			Literal: o.Inspect(),
+		}
+		return &BigIntLiteral{Token: t, Value: o.Value}
+	case *Float:
+		t := Token{
+			Type:    Flt,
+			Literal: o.Inspect(),
+		}
+		return &FloatLiteral{Token: t, Value: o.Value}
 	case *String:
 		t := Token{
 			Type:    Str,
@@ -27,6 +27,20 @@ func TestEvalInteger(t *testing.T) {
 		{"3*3*3+ 10", 37},
 		{"3*(3*3)+ 10", 37},
 		{"( 5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"3 ** 0", 1},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"1 << 4", 16},
+		{"-16 >> 2", -4},
+		{"1 + 2 << 3", 17},
+		{"1 | 2 * 3", 7},
 	}
 	for _, tt := range tests {
 		ev := testEval(tt.input)
@@ -34,6 +48,77 @@ func TestEvalInteger(t *testing.T) {
 	}
 }
 
+func TestEvalFloat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"3.14", "3.14"},
+		{"1e-9", "1e-09"},
+		{"-2.5", "-2.5"},
+		{"0.1 + 0.2", "0.30000000000000004"},
+		{"7 / 2.0", "3.5"},
+		{"7.0 / 2", "3.5"},
+		{"1.5 * 2", "3.0"},
+		{"2 - 0.5", "1.5"},
+		{"7.5 % 2", "1.5"},
+		{"2 ** 0.5 ** 2", "1.189207115002721"},
+		{"2.0 ** -1", "0.5"},
+		{"1 == 1.0", "true"},
+		{"1 != 1.5", "true"},
+		{"1 < 1.5", "true"},
+		{"2.5 >= 3", "false"},
+		{"!0.0", "true"},
+		{`{1: "a"}[1.0]`, `"a"`},
+		{`{1.5: "a"}[1.5]`, `"a"`},
+		{"int(2.9)", "2"},
+		{"int(-2.9)", "-2"},
+		{`int(" 42 ")`, "42"},
+		{"float(3)", "3.0"},
+		{`float("1e3")`, "1000.0"},
+	}
+	for _, tt := range tests {
+		ev := testEval(tt.input)
+		if ev == nil || ev.Inspect() != tt.expected {
+			t.Errorf("%s: wrong value. want=%s got=%v", tt.input, tt.expected, ev)
+		}
+	}
+}
+
+func TestEvalBigInt(t *testing.T) {
+	tests := []struct {
+		input    string
+		plain    string
+		promoted string
+	}{
+		{"9223372036854775807 + 1", "-9223372036854775808", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "9223372036854775807", "-9223372036854775809"},
+		{"4294967296 * 4294967296", "0", "18446744073709551616"},
+		{"2 ** 64", "0", "18446744073709551616"},
+		{"1 << 63", "-9223372036854775808", "9223372036854775808"},
+		{"-(-9223372036854775807 - 1)", "-9223372036854775808", "9223372036854775808"},
+		{"99999999999999999999", "99999999999999999999", "99999999999999999999"},
+		{"99999999999999999999 - 99999999999999999998", "1", "1"},
+		{"~99999999999999999999", "-100000000000000000000", "-100000000000000000000"},
+		{"99999999999999999999 > 1", "true", "true"},
+		{"99999999999999999999 < 1.5", "false", "false"},
+		{"99999999999999999999 == 99999999999999999999", "true", "true"},
+		{"99999999999999999999 / 2.0", "5e+19", "5e+19"},
+		{`{99999999999999999999: "a"}[99999999999999999999]`, `"a"`, `"a"`},
+		{`int("99999999999999999999")`, "99999999999999999999", "99999999999999999999"},
+	}
+	for _, tt := range tests {
+		prg := NewParser(NewLexer(tt.input)).ParseProgram()
+		if got := Eval(prg, NewEnvironment()).Inspect(); got != tt.plain {
+			t.Errorf("%s: wrong value. want=%s got=%s", tt.input, tt.plain, got)
+		}
+		got := EvalWithOptions(prg, NewEnvironment(), EvalOptions{BigInt: true}).Inspect()
+		if got != tt.promoted {
+			t.Errorf("%s: wrong promoted value. want=%s got=%s", tt.input, tt.promoted, got)
+		}
+	}
+}
+
 func testEval(input string) Object {
 	p := NewParser(NewLexer(input))
 	prg := p.ParseProgram()
@@ -69,6 +154,12 @@ func TestEvalBoolean(t *testing.T) {
 		{"1 != 1", false},
 		{"1 != 2", true},
 		{"1 == 2", false},
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`1 == "1"`, false},
+		{`[1, [2]] == [1, [2]]`, true},
+		{`{"a": 1} == {"a": 1}`, true},
+		{`{"a": 1} != {"a": 2}`, true},
 	}
 	for _, tt := range tests {
 		t.Log("tt.input:", tt.input)
@@ -184,6 +275,22 @@ if (10 > 1) {
 		{"神業", "identifier not found: 神業"},
 		{`"Hello" - "world"`, "unknown operator: STRING - STRING"},
 		{`{"name": "Monkey"}[fn(x){ x }]`, "unknown as hash key: FUNCTION"},
+		{"10 / (5 - 5)", "division by zero: 10 / 0"},
+		{"10 % 0", "division by zero: 10 % 0"},
+		{"1 << -1", "negative shift count: 1 << -1"},
+		{"1 >> -2", "negative shift count: 1 >> -2"},
+		{"2 ** -1", "negative exponent: 2 ** -1"},
+		{`~"a"`, "unknown operator: ~STRING"},
+		{`"a" % 2`, "unknown operator: STRING % INTEGER"},
+		{"1.5 & 1", "unknown operator: FLOAT & INTEGER"},
+		{"1.0 / 0", "division by zero: 1.0 / 0.0"},
+		{"1.0 / -0.0", "division by zero: 1.0 / -0.0"},
+		{"2.5 % 0.0", "division by zero: 2.5 % 0.0"},
+		{`-"a" + 1.5`, "unknown operator: -STRING"},
+		{`"a" + 1.5`, "unknown operator: STRING + FLOAT"},
+		{"int(1e300)", "cannot convert 1e+300 to int"},
+		{`int("x")`, `cannot convert "x" to int`},
+		{`float(true)`, "argument to 'float' not supported, got BOOLEAN"},
 	}
 	for _, tt := range tests {
 		evl := testEval(tt.input)
@@ -270,6 +377,29 @@ let 新型ｍｋ２ = 新型(2);
 	testIntegerObject(t, testEval(input), 4)
 }
 
+func TestEvalAssign(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"let x = 1; x = 5; x", 5},
+		{"let x = 1; x = 5", 5},
+		{"let x = 2; x **= 3; x -= 1; x", 7},
+		{"let a = 0; let b = 0; a = b = 3; a + b", 6},
+		{"let x = 1; let f = fn() { x = 10 }; f(); x", 10},
+		{"let x = 1; let f = fn(x) { x = 10 }; f(2); x", 1},
+		{"let c = fn() { let n = 0; fn() { n += 1 } }(); c(); c()", 2},
+		{"let mk = fn() { let n = 0; [fn() { n += 10 }, fn() { n }] }; let p = mk(); p[0](); p[0](); p[1]()", 20},
+		{"let x = 1; x += (x = 10); x", 11},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+	testErrorCheck(t, testEval("y = 1"), "identifier not found: y")
+	testErrorCheck(t, testEval("let x = 1; x += true"), "unknown operator: INTEGER + BOOLEAN")
+	testIntegerObject(t, testEval("let x = 1; try { x = 1 / 0 } catch (e) { 0 }; x"), 1)
+}
+
 func TestStringEval(t *testing.T) {
 	exp := "hello 異世界!"
 	input := fmt.Sprintf(`"%s"`, exp)
@@ -314,11 +444,12 @@ func TestBuiltin(t *testing.T) {
 		{`last("異世界")`, "界"},
 		{`rest(["hello", "異", "世", "界"])`, `["異","世","界"]`},
 		{`rest("hello 異世界")`, `ello 異世界`},
-		{`push(["hello"], "異", "世", "界");`, `["hello", "異", "世", "界"]`},
-		{`let a = ["hello"]; push(a, "異", "世", "界"); a;`,
-			`["hello", "異", "世", "界"]`},
+		{`push(["hello"], "異", "世", "界");`, `["hello","異","世","界"]`},
+		{`let a = ["hello"]; push(a, "異", "世", "界"); a;`, `["hello"]`},
 		{`push("hello ", "異", "世", "界");`, `hello 異世界`},
-		{`let a = "hello "; push(a, "異", "世", "界"); a;`, `hello 異世界`},
+		{`let a = "hello "; push(a, "異", "世", "界"); a;`, `hello `},
+		{`push("a", 1, true)`, `a1true`},
+		{`let a = ["hello", "異"]; rest(a); a;`, `["hello","異"]`},
 	}
 	for _, tt := range tests {
 		evl := testEval(tt.input)
@@ -343,7 +474,12 @@ func TestBuiltin(t *testing.T) {
 				t.Errorf("wrong string. expected=%q, got=%q",
 					stxp, exp.Value)
 			}
-
+		case *SliceObj:
+			stxp, _ := tt.expected.(string)
+			if exp.Inspect() != stxp {
+				t.Errorf("wrong array. expected=%s, got=%s",
+					stxp, exp.Inspect())
+			}
 		}
 	}
 }
@@ -603,3 +739,275 @@ func TestExpandMacro(t *testing.T) {
 		}
 	}
 }
+
+func TestTryCatchEval(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { 1 + true } catch (e) { 2 }`, 2},
+		{`try { 1 + true } catch (e) { e["message"] }`, "unknown operator: INTEGER + BOOLEAN"},
+		{`try { 1 + true } catch (e) { e["kind"] }`, "TYPE_MISMATCH"},
+		{`try { throw("boom") } catch (e) { e["message"] }`, "boom"},
+		{`try { throw("boom") } catch (e) { e["kind"] }`, "THROWN"},
+		{`try { throw({"code": 7}) } catch (e) { e["value"]["code"] }`, 7},
+		{`let f = fn() { throw("in fn"); 1 }; try { f() } catch (e) { e["message"] }`, "in fn"},
+		{`try { try { throw(1) } catch (e) { throw(e["value"] + 1) } } catch (e) { e["value"] }`, 2},
+		{`let f = fn() { try { return 5 } catch (e) { 0 } }; f()`, 5},
+		{`try { 1 / 0 } catch (e) { e["kind"] }`, "DIVISION_BY_ZERO"},
+		{`try { } catch (e) { 1 }`, nil},
+	}
+	for _, tt := range tests {
+		evl := testEval(tt.input)
+		switch exp := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evl, exp)
+		case string:
+			str, ok := evl.(*String)
+			if !ok {
+				t.Errorf("%s: obj is not string. got=%T (%+v)", tt.input, evl, evl)
+				continue
+			}
+			if str.Value != exp {
+				t.Errorf("%s: wrong value. want=%q got=%q", tt.input, exp, str.Value)
+			}
+		case nil:
+			testNullObject(t, evl)
+		}
+	}
+}
+
+func TestThrowUncaught(t *testing.T) {
+	evl := testEval(`throw("boom"); 1`)
+	if !testErrorCheck(t, evl, "boom") {
+		return
+	}
+	if err := evl.(*Error); err.Kind != KindThrown {
+		t.Errorf("wrong kind. want=%s got=%s", KindThrown, err.Kind)
+	}
+}
+
+func TestEvalRecoversPanic(t *testing.T) {
+	Builtins["explode"] = &Builtin{Fn: func(args ...Object) Object {
+		panic("kaboom")
+	}}
+	defer delete(Builtins, "explode")
+	evl := testEval(`explode()`)
+	if testErrorCheck(t, evl, "internal error: kaboom") {
+		if err := evl.(*Error); err.Kind != KindInternal {
+			t.Errorf("wrong kind. want=%s got=%s", KindInternal, err.Kind)
+		}
+	}
+}
+
+func TestEvalWithOptions(t *testing.T) {
+	countdown := `
+let countdown = fn(n) {
+	if (n == 0) { 0 } else { 1 + countdown(n - 1) }
+};
+`
+	tests := []struct {
+		input    string
+		opts     EvalOptions
+		expected string
+	}{
+		{countdown + "countdown(100)", EvalOptions{MaxSteps: 1000}, "step limit exceeded: 1000"},
+		{countdown + "try { countdown(100) } catch (e) { 0 }", EvalOptions{MaxSteps: 1000},
+			"step limit exceeded: 1000"},
+		{countdown + "countdown(100)", EvalOptions{MaxDepth: 20}, "depth limit exceeded: 20"},
+		{"[[[[[[1]]]]]]", EvalOptions{MaxDepth: 5}, "depth limit exceeded: 5"},
+	}
+	for _, tt := range tests {
+		prg := NewParser(NewLexer(tt.input)).ParseProgram()
+		evl := EvalWithOptions(prg, NewEnvironment(), tt.opts)
+		if !testErrorCheck(t, evl, tt.expected) {
+			continue
+		}
+		if err := evl.(*Error); err.Kind != KindBudgetExceeded {
+			t.Errorf("wrong kind. want=%s got=%s", KindBudgetExceeded, err.Kind)
+		}
+	}
+
+	prg := NewParser(NewLexer(countdown + "countdown(10)")).ParseProgram()
+	evl := EvalWithOptions(prg, NewEnvironment(), EvalOptions{MaxSteps: 100000, MaxDepth: 200})
+	testIntegerObject(t, evl, 10)
+}
+
+func TestEvalStackOverflow(t *testing.T) {
+	prg := NewParser(NewLexer("let f = fn() { f() };\nf()")).ParseProgram()
+	evl := Eval(prg, NewEnvironment())
+	if !testErrorCheck(t, evl, "stack overflow: maximum call depth 1024 exceeded") {
+		return
+	}
+	err := evl.(*Error)
+	if err.Kind != KindStackOverflow {
+		t.Errorf("wrong kind. want=%s got=%s", KindStackOverflow, err.Kind)
+	}
+	if len(err.Trace) != DefaultMaxFrames {
+		t.Fatalf("wrong trace length. want=%d got=%d", DefaultMaxFrames, len(err.Trace))
+	}
+	if f := err.Trace[0]; f.Function != "f" || f.Line != 1 {
+		t.Errorf("wrong innermost frame. got=%s", f)
+	}
+	if f := err.Trace[len(err.Trace)-1]; f.Function != mainName || f.Line != 2 {
+		t.Errorf("wrong outermost frame. got=%s", f)
+	}
+
+	tests := []struct {
+		input    string
+		opts     EvalOptions
+		expected int
+	}{
+		{`let f = fn() { f() }; try { f() } catch (e) { 1 }`, EvalOptions{MaxFrames: 10}, 1},
+		{`let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(1500)`,
+			EvalOptions{MaxFrames: 2000}, 0},
+	}
+	for _, tt := range tests {
+		prg := NewParser(NewLexer(tt.input)).ParseProgram()
+		testIntegerObject(t, EvalWithOptions(prg, NewEnvironment(), tt.opts), tt.expected)
+	}
+}
+
+func TestEnvironmentRegisterBuiltin(t *testing.T) {
+	env := NewEnvironment()
+	env.RegisterBuiltin("double", func(args ...Object) Object {
+		return &Integer{Primitive[int]{args[0].(*Integer).Value * 2}}
+	})
+	env.RegisterBuiltin("len", func(args ...Object) Object {
+		return &Integer{Primitive[int]{-1}}
+	})
+	prg := NewParser(NewLexer(`let f = fn(x) { double(x) }; f(21) + len("abc")`)).ParseProgram()
+	testIntegerObject(t, Eval(prg, env), 41)
+
+	prg = NewParser(NewLexer(`double(1)`)).ParseProgram()
+	testErrorCheck(t, Eval(prg, NewEnvironment()), "identifier not found: double")
+}
+
+func TestInfixDoesNotMutateOperands(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"let a = 5; let b = a + 1; a", 5},
+		{"let a = 5; let b = a - 1; let c = a * 2; let d = a / 5; a", 5},
+		{"let a = 5; let b = -a; a", 5},
+		{"let f = fn(x) { if (x < 2) { x } else { f(x - 1) + f(x - 2) } }; f(10)", 55},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+	if str, ok := testEval(`let s = "a"; let t = s + "b"; s`).(*String); !ok || str.Value != "a" {
+		t.Errorf("string operand is mutated. got=%v", str)
+	}
+}
+
+func TestStringIndex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`"abc"[0]`, "a"},
+		{`"abc"[2]`, "c"},
+		{`"異世界"[1]`, "世"},
+		{`"abc"[3]`, nil},
+		{`"abc"[-1]`, nil},
+	}
+	for _, tt := range tests {
+		o := testEval(tt.input)
+		if tt.expected == nil {
+			testNullObject(t, o)
+			continue
+		}
+		if str, ok := o.(*String); !ok || str.Value != tt.expected {
+			t.Errorf("%s: got=%v, want=%q", tt.input, o, tt.expected)
+		}
+	}
+}
+
+func TestHashInspectIsSorted(t *testing.T) {
+	want := `{"a":1,"b":2,"c":3}`
+	for range 10 {
+		if got := testEval(`{"c": 3, "a": 1, "b": 2}`).Inspect(); got != want {
+			t.Fatalf("got=%s, want=%s", got, want)
+		}
+	}
+}
+
+func TestEvalLogical(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && 2", true},
+		{"0 || 0", false},
+		{"1 < 2 && 2 < 3 || false", true},
+		{"false && 1 / 0", false},
+		{"true || 1 / 0", true},
+		{`false && throw("called")`, false},
+		{`!false && !0`, true},
+	}
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+	testErrorCheck(t, testEval("true && 1 / 0"), "division by zero: 1 / 0")
+}
+
+func TestEvalLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let i = 0; while (i < 5) { let i = i + 1 }; i", 5},
+		{`let s = 0; for (let i = 0; i < 10; let i = i + 1) {
+			if (i % 2 == 0) { continue }
+			if (i > 7) { break }
+			let s = s + i;
+		}; s`, 16},
+		{"let n = 0; for (;;) { let n = n + 1; if (n == 3) { break } }; n", 3},
+		{"while (false) { 1 }", nil},
+		{"for (let i = 0; i < 3; let i = i + 1) { i }", nil},
+		{"let f = fn() { while (true) { return 7 } }; f()", 7},
+		{"let f = fn(n) { for (let i = 0; true; let i = i + 1) { if (i * i >= n) { return i } } }; f(50)", 8},
+		{"let i = 0; while (i < 3) { try { let i = i + 1; break } catch (e) { 0 } }; i", 1},
+	}
+	for _, tt := range tests {
+		evl := testEval(tt.input)
+		if i, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evl, i)
+		} else {
+			testNullObject(t, evl)
+		}
+	}
+	testErrorCheck(t, testEval("while (true) { 1 + true }"), "unknown operator: INTEGER + BOOLEAN")
+
+	prg := NewParser(NewLexer("while (true) { }")).ParseProgram()
+	evl := EvalWithOptions(prg, NewEnvironment(), EvalOptions{MaxSteps: 1000})
+	testErrorCheck(t, evl, "step limit exceeded: 1000")
+}
+
+func TestEvalStringOrdering(t *testing.T) {
+	tests := []struct {
+		input    string
+		plain    bool
+		collated bool
+	}{
+		{`"a" < "b"`, true, true},
+		{`"abc" >= "ab"`, true, true},
+		{`"Z" < "a"`, true, false},
+		{`"é" < "f"`, false, true},
+	}
+	for _, tt := range tests {
+		prg := NewParser(NewLexer(tt.input)).ParseProgram()
+		testBooleanObject(t, Eval(prg, NewEnvironment()), tt.plain)
+		testBooleanObject(t, EvalWithOptions(prg, NewEnvironment(), EvalOptions{Collate: true}), tt.collated)
+	}
+	env := NewEnvironment()
+	env.RegisterBuiltin("compare", CollatedCompare)
+	prg := NewParser(NewLexer(`compare("Z", "a")`)).ParseProgram()
+	testIntegerObject(t, Eval(prg, env), 1)
+}
@@ -1,6 +1,7 @@
 package interp
 
 import (
+	"regexp"
 	"unicode"
 	"unicode/utf8"
 )
@@ -11,6 +12,12 @@ type pos struct {
 	bytecol uint
 }
 
+// Line returns the 1-based line of the position.
+func (p pos) Line() int { return int(p.line) }
+
+// Column returns the 1-based column, counted in runes, of the position.
+func (p pos) Column() int { return int(p.column) }
+
 type Lexer struct {
 	inputUtf8    []byte
 	inputStr     string
@@ -36,36 +43,63 @@ func (l *Lexer) forward(sz uint) {
 }
 
 var mapTokenLexer = map[string]TokenType{
-	"=":      Assign,
-	"+":      Plus,
-	"(":      Lparen,
-	")":      Rparen,
-	"{":      Lbrace,
-	"}":      Rbrace,
-	",":      Comma,
-	";":      Semicolon,
-	"let":    Let,
-	"fn":     Fn,
-	"!":      Bang,
-	"*":      Star,
-	"/":      Slash,
-	">":      Gt,
-	"<":      Lt,
-	"-":      Minus,
-	"return": Return,
-	"if":     If,
-	"else":   Else,
-	"true":   True,
-	"false":  False,
-	"!=":     Neq,
-	">=":     Gte,
-	"<=":     Lte,
-	"==":     Eq,
-	"\"":     Str,
-	"[":      Lbracket,
-	"]":      Rbracket,
-	":":      Colon,
-	"macro":  Macro,
+	"=":        Assign,
+	"+":        Plus,
+	"(":        Lparen,
+	")":        Rparen,
+	"{":        Lbrace,
+	"}":        Rbrace,
+	",":        Comma,
+	";":        Semicolon,
+	"let":      Let,
+	"fn":       Fn,
+	"!":        Bang,
+	"*":        Star,
+	"/":        Slash,
+	">":        Gt,
+	"<":        Lt,
+	"-":        Minus,
+	"return":   Return,
+	"if":       If,
+	"else":     Else,
+	"true":     True,
+	"false":    False,
+	"!=":       Neq,
+	">=":       Gte,
+	"<=":       Lte,
+	"==":       Eq,
+	"\"":       Str,
+	"[":        Lbracket,
+	"]":        Rbracket,
+	":":        Colon,
+	"macro":    Macro,
+	"try":      Try,
+	"catch":    Catch,
+	"%":        Percent,
+	"**":       Pow,
+	"&":        Amp,
+	"|":        Pipe,
+	"^":        Caret,
+	"<<":       Shl,
+	">>":       Shr,
+	"~":        Tilde,
+	"&&":       And,
+	"||":       Or,
+	"while":    While,
+	"for":      For,
+	"break":    Break,
+	"continue": Continue,
+	"+=":       PlusAssign,
+	"-=":       MinusAssign,
+	"*=":       StarAssign,
+	"/=":       SlashAssign,
+	"%=":       PercentAssign,
+	"**=":      PowAssign,
+	"&=":       AmpAssign,
+	"|=":       PipeAssign,
+	"^=":       CaretAssign,
+	"<<=":      ShlAssign,
+	">>=":      ShrAssign,
 }
 
 func (l *Lexer) skipWhitespaces() {
@@ -98,9 +132,23 @@ func (l *Lexer) getUntilSpaceOrOperator(p *[]byte) {
 	}
 }
 
+var (
+	floatLiteral = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+	// floatMantissa is a float literal up to its exponent sign, which is
+	// read as an operator otherwise.
+	floatMantissa = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[eE]$`)
+)
+
 func (l *Lexer) tokenize(r rune) Token {
 	buf := utf8.AppendRune(nil, r)
 	l.getUntilSpaceOrOperator(&buf)
+	if sign, size := utf8.DecodeRune(l.inputUtf8); (sign == '+' || sign == '-') && floatMantissa.Match(buf) {
+		l.position++
+		l.forward(uint(size))
+		l.inputUtf8 = l.inputUtf8[size:]
+		buf = utf8.AppendRune(buf, sign)
+		l.getUntilSpaceOrOperator(&buf)
+	}
 	cursize := 0
 	isNumber := true
 	for rr, rsize := utf8.DecodeRune(buf[cursize:]); len(buf[cursize:]) > 0; rr, rsize = utf8.DecodeRune(buf[cursize:]) {
@@ -116,6 +164,9 @@ func (l *Lexer) tokenize(r rune) Token {
 	if isNumber {
 		return Token{Int, bstr, lpos}
 	}
+	if floatLiteral.Match(buf) {
+		return Token{Flt, bstr, lpos}
+	}
 	t, ok := mapTokenLexer[bstr]
 	if ok {
 		return Token{t, bstr, lpos}
@@ -123,27 +174,27 @@ func (l *Lexer) tokenize(r rune) Token {
 	return Token{Ident, bstr, lpos}
 }
 
+// getCombined returns the longest operator starting with r, like "<<="
+// rather than "<" or "<<".
 func (l *Lexer) getCombined(t TokenType, r rune) Token {
-	switch string(r) {
-	case "=", "<", ">", "!":
-		rr := utf8.AppendRune(nil, r)
-		r, size := utf8.DecodeRune(l.inputUtf8)
-		rr = utf8.AppendRune(rr, r)
-		tt, ok := mapTokenLexer[string(rr)]
-		if ok {
-			l.position++
-			l.forward(uint(size))
-			l.inputUtf8 = l.inputUtf8[size:]
-			lpos := l.pos
-			lpos.column -= 2 + 1
-			return Token{tt, string(rr), l.pos}
-		}
-	case "\"":
+	if string(r) == "\"" {
 		return l.readString()
 	}
 	lpos := l.pos
-	lpos.column -= 1
-	return Token{t, string(r), l.pos}
+	op := utf8.AppendRune(nil, r)
+	for len(l.inputUtf8) > 0 {
+		next, size := utf8.DecodeRune(l.inputUtf8)
+		combined := utf8.AppendRune(append([]byte{}, op...), next)
+		tt, ok := mapTokenLexer[string(combined)]
+		if !ok {
+			break
+		}
+		l.position++
+		l.forward(uint(size))
+		l.inputUtf8 = l.inputUtf8[size:]
+		op, t = combined, tt
+	}
+	return Token{t, string(op), lpos}
 }
 
 func (l *Lexer) getToken() Token {
@@ -202,7 +253,7 @@ func (l *Lexer) readString() Token {
 		forwardTimes++
 	}
 	lpos := l.pos
-	lpos.column -= uint(forwardTimes) + 1
+	lpos.column -= uint(forwardTimes)
 	return Token{Str, string(rr), lpos}
 }
 
@@ -348,3 +348,164 @@ func TestNextToken_macro(t *testing.T) {
 		}
 	}
 }
+
+func TestNextToken_operators(t *testing.T) {
+	input := `a % b ** c&d | e^f << 1 >> 2 ~g <= h**-1 && i||!j`
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{Ident, "a"},
+		{Percent, "%"},
+		{Ident, "b"},
+		{Pow, "**"},
+		{Ident, "c"},
+		{Amp, "&"},
+		{Ident, "d"},
+		{Pipe, "|"},
+		{Ident, "e"},
+		{Caret, "^"},
+		{Ident, "f"},
+		{Shl, "<<"},
+		{Int, "1"},
+		{Shr, ">>"},
+		{Int, "2"},
+		{Tilde, "~"},
+		{Ident, "g"},
+		{Lte, "<="},
+		{Ident, "h"},
+		{Pow, "**"},
+		{Minus, "-"},
+		{Int, "1"},
+		{And, "&&"},
+		{Ident, "i"},
+		{Or, "||"},
+		{Bang, "!"},
+		{Ident, "j"},
+		{Eof, ""},
+	}
+	l := NewLexer(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got %q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token literal wrong. expected=%q, got %q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextToken_float(t *testing.T) {
+	input := `3.14 1e-9 2.5E+3 x-1 1e3-1 0.5*2`
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{Flt, "3.14"},
+		{Flt, "1e-9"},
+		{Flt, "2.5E+3"},
+		{Ident, "x"},
+		{Minus, "-"},
+		{Int, "1"},
+		{Flt, "1e3"},
+		{Minus, "-"},
+		{Int, "1"},
+		{Flt, "0.5"},
+		{Star, "*"},
+		{Int, "2"},
+		{Eof, ""},
+	}
+	l := NewLexer(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got %q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token literal wrong. expected=%q, got %q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextToken_loops(t *testing.T) {
+	input := `while for break continue whiles`
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{While, "while"},
+		{For, "for"},
+		{Break, "break"},
+		{Continue, "continue"},
+		{Ident, "whiles"},
+		{Eof, ""},
+	}
+	l := NewLexer(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got %q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token literal wrong. expected=%q, got %q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextToken_assign(t *testing.T) {
+	input := `x = 1; x += 2 -= 3 *= 4 /= 5 %= 6 **= 7 &= 8 |= 9 ^= 1 <<= 2 >>= 3 == 4`
+	tests := []struct {
+		expectedType    TokenType
+		expectedLiteral string
+	}{
+		{Ident, "x"},
+		{Assign, "="},
+		{Int, "1"},
+		{Semicolon, ";"},
+		{Ident, "x"},
+		{PlusAssign, "+="},
+		{Int, "2"},
+		{MinusAssign, "-="},
+		{Int, "3"},
+		{StarAssign, "*="},
+		{Int, "4"},
+		{SlashAssign, "/="},
+		{Int, "5"},
+		{PercentAssign, "%="},
+		{Int, "6"},
+		{PowAssign, "**="},
+		{Int, "7"},
+		{AmpAssign, "&="},
+		{Int, "8"},
+		{PipeAssign, "|="},
+		{Int, "9"},
+		{CaretAssign, "^="},
+		{Int, "1"},
+		{ShlAssign, "<<="},
+		{Int, "2"},
+		{ShrAssign, ">>="},
+		{Int, "3"},
+		{Eq, "=="},
+		{Int, "4"},
+		{Eof, ""},
+	}
+	l := NewLexer(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got %q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token literal wrong. expected=%q, got %q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
@@ -0,0 +1,475 @@
+package interp
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+)
+
+// tagName is the struct field tag read by FromGo and ToGo. The tag value
+// is the hash key of the field, "-" skips the field.
+const tagName = "compgo"
+
+// UnsupportedTypeError is returned by FromGo for a Go value that has no
+// script equivalent. Path locates the value inside the one passed in.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+	Path string
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("unsupported Go type %s at %s", e.Type, pathOrRoot(e.Path))
+}
+
+// CyclicValueError is returned by FromGo for a Go value containing
+// itself. Path locates where the value is met again.
+type CyclicValueError struct {
+	Type reflect.Type
+	Path string
+}
+
+func (e *CyclicValueError) Error() string {
+	return fmt.Sprintf("cyclic Go value of type %s at %s", e.Type, pathOrRoot(e.Path))
+}
+
+// UnmarshalTypeError is returned by ToGo when an object cannot be stored
+// in a Go value of Type.
+type UnmarshalTypeError struct {
+	Object ObjectType
+	Type   reflect.Type
+	Path   string
+	// Reason tells why when the types alone do not, e.g. an overflow.
+	Reason string
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	msg := fmt.Sprintf("cannot store %s in Go type %s at %s", e.Object, e.Type, pathOrRoot(e.Path))
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// InvalidTargetError is returned by ToGo when the target is not a non-nil
+// pointer.
+type InvalidTargetError struct {
+	Type reflect.Type
+}
+
+func (e *InvalidTargetError) Error() string {
+	if e.Type == nil {
+		return "ToGo target is nil"
+	}
+	return fmt.Sprintf("ToGo target is not a non-nil pointer: %s", e.Type)
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "value"
+	}
+	return path
+}
+
+// FromGo converts numbers, bools, strings, slices, arrays, maps and
+// structs in v to the matching script objects, and nil to null.
+func FromGo(v any) (Object, error) {
+	return FromGoWithOptions(v, EvalOptions{})
+}
+
+// FromGoWithOptions is FromGo for scripts run with opts. With BigInt, an
+// unsigned integer overflowing an int becomes a BigInteger.
+func FromGoWithOptions(v any, opts EvalOptions) (Object, error) {
+	c := &goConverter{visiting: map[visit]bool{}, bigInt: opts.BigInt}
+	return c.fromGo(reflect.ValueOf(v), "")
+}
+
+// goConverter converts Go values for FromGo. visiting holds the pointers,
+// maps and slices on the path being converted.
+type goConverter struct {
+	visiting map[visit]bool
+	bigInt   bool
+}
+
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// enter marks v as being converted, failing when it already is, and
+// returns the function unmarking it.
+func (c *goConverter) enter(v reflect.Value, path string) (func(), error) {
+	k := visit{v.Pointer(), v.Type(), 0}
+	if v.Kind() == reflect.Slice {
+		k.len = v.Len()
+	}
+	if c.visiting[k] {
+		return nil, &CyclicValueError{v.Type(), path}
+	}
+	c.visiting[k] = true
+	return func() { delete(c.visiting, k) }, nil
+}
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+func (c *goConverter) fromGo(v reflect.Value, path string) (Object, error) {
+	if !v.IsValid() {
+		return NullObject, nil
+	}
+	if v.Type().Implements(objectType) {
+		if v.IsNil() {
+			return NullObject, nil
+		}
+		return v.Interface().(Object), nil
+	}
+	if v.Type() == bigIntType && v.CanInterface() {
+		if v.IsNil() {
+			return NullObject, nil
+		}
+		return NewBigInteger(new(big.Int).Set(v.Interface().(*big.Int))), nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Primitive[int]{int(v.Int())}}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		if u > uint64(^uint(0)>>1) {
+			if c.bigInt {
+				return NewBigInteger(new(big.Int).SetUint64(u)), nil
+			}
+			return nil, &UnsupportedTypeError{v.Type(), path}
+		}
+		return &Integer{Primitive[int]{int(u)}}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Float{Primitive[float64]{v.Float()}}, nil
+	case reflect.Bool:
+		if v.Bool() {
+			return TrueObject, nil
+		}
+		return FalseObject, nil
+	case reflect.String:
+		return &String{Primitive[string]{v.String()}}, nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return NullObject, nil
+		}
+		if v.Kind() == reflect.Pointer {
+			leave, err := c.enter(v, path)
+			if err != nil {
+				return nil, err
+			}
+			defer leave()
+		}
+		return c.fromGo(v.Elem(), path)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			if v.IsNil() {
+				return NullObject, nil
+			}
+			leave, err := c.enter(v, path)
+			if err != nil {
+				return nil, err
+			}
+			defer leave()
+		}
+		sl := &SliceObj{Elements: make([]Object, v.Len())}
+		for i := range sl.Elements {
+			elm, err := c.fromGo(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			sl.Elements[i] = elm
+		}
+		return sl, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return NullObject, nil
+		}
+		leave, err := c.enter(v, path)
+		if err != nil {
+			return nil, err
+		}
+		defer leave()
+		h := &Hash{Pairs: map[HashKey]HashPair{}}
+		iter := v.MapRange()
+		for iter.Next() {
+			kpath := fmt.Sprintf("%s[%v]", path, iter.Key())
+			k, err := c.fromGo(iter.Key(), kpath)
+			if err != nil {
+				return nil, err
+			}
+			hk, ok := k.(Hashable)
+			if !ok {
+				return nil, &UnsupportedTypeError{v.Type(), path}
+			}
+			val, err := c.fromGo(iter.Value(), kpath)
+			if err != nil {
+				return nil, err
+			}
+			h.Pairs[hk.HashKey()] = HashPair{k, val}
+		}
+		return h, nil
+	case reflect.Struct:
+		h := &Hash{Pairs: map[HashKey]HashPair{}}
+		for _, f := range structFields(v.Type()) {
+			val, err := c.fromGo(v.Field(f.index), joinPath(path, f.name))
+			if err != nil {
+				return nil, err
+			}
+			k := &String{Primitive[string]{f.name}}
+			h.Pairs[k.HashKey()] = HashPair{k, val}
+		}
+		return h, nil
+	}
+	return nil, &UnsupportedTypeError{v.Type(), path}
+}
+
+// ToGo stores o in the Go value target points to, reversing FromGo. An
+// empty interface receives the natural Go type of o.
+func ToGo(o Object, target any) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return &InvalidTargetError{reflect.TypeOf(target)}
+	}
+	return toGo(o, v.Elem(), "")
+}
+
+func toGo(o Object, v reflect.Value, path string) error {
+	if o == nil {
+		o = NullObject
+	}
+	mismatch := func(reason string) error {
+		return &UnmarshalTypeError{o.Type(), v.Type(), path, reason}
+	}
+	if v.Type() == objectType {
+		v.Set(reflect.ValueOf(o))
+		return nil
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		native, err := toNative(o, path)
+		if err != nil {
+			return err
+		}
+		if native == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(native))
+		}
+		return nil
+	}
+	if _, ok := o.(*Null); ok {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Type() == bigIntType.Elem() {
+		switch n := o.(type) {
+		case *Integer:
+			v.Set(reflect.ValueOf(*big.NewInt(int64(n.Value))))
+		case *BigInteger:
+			v.Set(reflect.ValueOf(*new(big.Int).Set(n.Value)))
+		default:
+			return mismatch("")
+		}
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		elm := reflect.New(v.Type().Elem())
+		if err := toGo(o, elm.Elem(), path); err != nil {
+			return err
+		}
+		v.Set(elm)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := o.(*Integer)
+		if !ok {
+			return mismatch("")
+		}
+		if v.OverflowInt(int64(i.Value)) {
+			return mismatch(fmt.Sprintf("%d overflows", i.Value))
+		}
+		v.SetInt(int64(i.Value))
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := o.(*Integer)
+		if !ok {
+			return mismatch("")
+		}
+		if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+			return mismatch(fmt.Sprintf("%d overflows", i.Value))
+		}
+		v.SetUint(uint64(i.Value))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch n := o.(type) {
+		case *Integer:
+			f = float64(n.Value)
+		case *Float:
+			f = n.Value
+		default:
+			return mismatch("")
+		}
+		if v.OverflowFloat(f) {
+			return mismatch(fmt.Sprintf("%s overflows", formatFloat(f)))
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.Bool:
+		b, ok := o.(*Boolean)
+		if !ok {
+			return mismatch("")
+		}
+		v.SetBool(b.Value)
+		return nil
+	case reflect.String:
+		s, ok := o.(*String)
+		if !ok {
+			return mismatch("")
+		}
+		v.SetString(s.Value)
+		return nil
+	case reflect.Slice, reflect.Array:
+		sl, ok := o.(*SliceObj)
+		if !ok {
+			return mismatch("")
+		}
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(v.Type(), len(sl.Elements), len(sl.Elements)))
+		} else if len(sl.Elements) > v.Len() {
+			return mismatch(fmt.Sprintf("%d elements do not fit", len(sl.Elements)))
+		}
+		for i, elm := range sl.Elements {
+			if err := toGo(elm, v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		h, ok := o.(*Hash)
+		if !ok {
+			return mismatch("")
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(h.Pairs))
+		for _, pair := range h.Pairs {
+			kpath := fmt.Sprintf("%s[%s]", path, pair.Key.Inspect())
+			k := reflect.New(v.Type().Key()).Elem()
+			if err := toGo(pair.Key, k, kpath); err != nil {
+				return err
+			}
+			val := reflect.New(v.Type().Elem()).Elem()
+			if err := toGo(pair.Value, val, kpath); err != nil {
+				return err
+			}
+			m.SetMapIndex(k, val)
+		}
+		v.Set(m)
+		return nil
+	case reflect.Struct:
+		h, ok := o.(*Hash)
+		if !ok {
+			return mismatch("")
+		}
+		for _, f := range structFields(v.Type()) {
+			k := &String{Primitive[string]{f.name}}
+			pair, ok := h.Pairs[k.HashKey()]
+			if !ok {
+				continue
+			}
+			if err := toGo(pair.Value, v.Field(f.index), joinPath(path, f.name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return mismatch("")
+}
+
+// toNative converts o to the plain Go value stored in an empty interface.
+func toNative(o Object, path string) (any, error) {
+	switch obj := o.(type) {
+	case nil, *Null:
+		return nil, nil
+	case *Integer:
+		return obj.Value, nil
+	case *BigInteger:
+		return new(big.Int).Set(obj.Value), nil
+	case *Float:
+		return obj.Value, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *SliceObj:
+		res := make([]any, len(obj.Elements))
+		for i, elm := range obj.Elements {
+			native, err := toNative(elm, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			res[i] = native
+		}
+		return res, nil
+	case *Hash:
+		strKeys := map[string]any{}
+		anyKeys := map[any]any{}
+		for _, pair := range obj.Pairs {
+			kpath := fmt.Sprintf("%s[%s]", path, pair.Key.Inspect())
+			k, err := toNative(pair.Key, kpath)
+			if err != nil {
+				return nil, err
+			}
+			val, err := toNative(pair.Value, kpath)
+			if err != nil {
+				return nil, err
+			}
+			if s, ok := k.(string); ok && strKeys != nil {
+				strKeys[s] = val
+			} else {
+				strKeys = nil
+			}
+			anyKeys[k] = val
+		}
+		if strKeys != nil {
+			return strKeys, nil
+		}
+		return anyKeys, nil
+	}
+	return nil, &UnmarshalTypeError{Object: o.Type(), Type: reflect.TypeOf((*any)(nil)).Elem(), Path: path}
+}
+
+type structField struct {
+	name  string
+	index int
+}
+
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup(tagName); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, structField{name, i})
+	}
+	return fields
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
@@ -0,0 +1,279 @@
+package interp
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+type marshalItem struct {
+	Name  string `compgo:"name"`
+	Count int    `compgo:"count"`
+	Tags  []string
+	Skip  bool `compgo:"-"`
+	inner int
+}
+
+func TestFromGo(t *testing.T) {
+	tests := []struct {
+		input    any
+		expected string
+	}{
+		{nil, "<nil>"},
+		{42, "42"},
+		{uint8(7), "7"},
+		{1.5, "1.5"},
+		{float32(2), "2.0"},
+		{true, "true"},
+		{"異世界", `"異世界"`},
+		{[]int{1, 2, 3}, "[1,2,3]"},
+		{[2]bool{true, false}, "[true,false]"},
+		{map[string]int{"a": 1}, `{"a": 1}`},
+		{map[int]string{1: "a"}, `{1: "a"}`},
+		{map[bool][]int{true: {1}}, `{true: [1]}`},
+		{&marshalItem{Name: "x", Count: 2, Tags: []string{"t"}, Skip: true},
+			`{"name": "x", "count": 2, "Tags": ["t"]}`},
+		{(*marshalItem)(nil), "<nil>"},
+		{[]any{1, "a", nil}, `[1,"a",<nil>]`},
+	}
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+		if err != nil {
+			t.Errorf("%#v: %s", tt.input, err)
+			continue
+		}
+		if !equalInspect(obj, tt.expected) {
+			t.Errorf("%#v: wrong object. want=%s got=%s", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+}
+
+// equalInspect compares hashes regardless of their pair order.
+func equalInspect(obj Object, expected string) bool {
+	if obj.Inspect() == expected {
+		return true
+	}
+	h, ok := obj.(*Hash)
+	if !ok {
+		return false
+	}
+	p := NewParser(NewLexer(expected))
+	lit, ok := p.ParseProgram().Statements[0].(*ExpressionStatement).Expression.(*HashLiteral)
+	if !ok || len(lit.Pairs) != len(h.Pairs) {
+		return false
+	}
+	for k, v := range lit.Pairs {
+		key := Eval(k, NewEnvironment()).(Hashable)
+		pair, ok := h.Pairs[key.HashKey()]
+		if !ok || pair.Value.Inspect() != Eval(v, NewEnvironment()).Inspect() {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFromGo_errors(t *testing.T) {
+	tests := []struct {
+		input any
+		path  string
+	}{
+		{1.5i, ""},
+		{[]any{1, func() {}}, "[1]"},
+		{map[string]any{"a": []any{make(chan int)}}, "[a][0]"},
+		{struct{ F complex128 }{}, "F"},
+		{map[complex128]int{1: 1}, "[(1+0i)]"},
+		{uint64(1 << 63), ""},
+	}
+	for _, tt := range tests {
+		_, err := FromGo(tt.input)
+		var terr *UnsupportedTypeError
+		if !errors.As(err, &terr) {
+			t.Errorf("%#v: wrong error. got=%T (%v)", tt.input, err, err)
+			continue
+		}
+		if terr.Path != tt.path {
+			t.Errorf("%#v: wrong path. want=%q got=%q", tt.input, tt.path, terr.Path)
+		}
+	}
+}
+
+func TestFromGoWithOptions(t *testing.T) {
+	tests := []struct {
+		input    any
+		expected string
+	}{
+		{uint64(1 << 63), "9223372036854775808"},
+		{[]uint{1, 1<<64 - 1}, "[1,18446744073709551615]"},
+		{uint64(5), "5"},
+	}
+	for _, tt := range tests {
+		obj, err := FromGoWithOptions(tt.input, EvalOptions{BigInt: true})
+		if err != nil {
+			t.Errorf("%#v: %s", tt.input, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("%#v: wrong object. want=%s got=%s", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+}
+
+type marshalNode struct {
+	Next *marshalNode
+}
+
+func TestFromGo_cyclic(t *testing.T) {
+	node := &marshalNode{}
+	node.Next = node
+	m := map[string]any{}
+	m["self"] = m
+	sl := []any{nil}
+	sl[0] = sl
+	tests := []struct {
+		input any
+		path  string
+	}{
+		{node, "Next"},
+		{m, "[self]"},
+		{sl, "[0]"},
+		{[]any{[]any{m}}, "[0][0][self]"},
+	}
+	for _, tt := range tests {
+		_, err := FromGo(tt.input)
+		var cerr *CyclicValueError
+		if !errors.As(err, &cerr) {
+			t.Errorf("%T: wrong error. got=%T (%v)", tt.input, err, err)
+			continue
+		}
+		if cerr.Path != tt.path {
+			t.Errorf("%T: wrong path. want=%q got=%q", tt.input, tt.path, cerr.Path)
+		}
+	}
+
+	// a value met twice but not inside itself is not a cycle
+	shared := &marshalItem{Name: "x"}
+	obj, err := FromGo([]*marshalItem{shared, shared})
+	if err != nil {
+		t.Fatalf("shared value: %s", err)
+	}
+	if len(obj.(*SliceObj).Elements) != 2 {
+		t.Errorf("wrong object. got=%s", obj.Inspect())
+	}
+}
+
+func TestToGo(t *testing.T) {
+	eval := func(src string) Object {
+		return testEval(src)
+	}
+
+	var item marshalItem
+	if err := ToGo(eval(`{"name": "x", "count": 2, "Tags": ["a", "b"], "Skip": true, "other": 1}`), &item); err != nil {
+		t.Fatal(err)
+	}
+	want := marshalItem{Name: "x", Count: 2, Tags: []string{"a", "b"}}
+	if !reflect.DeepEqual(item, want) {
+		t.Errorf("wrong struct. want=%+v got=%+v", want, item)
+	}
+
+	var m map[int]bool
+	if err := ToGo(eval(`{1: true, 2: false}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, map[int]bool{1: true, 2: false}) {
+		t.Errorf("wrong map. got=%v", m)
+	}
+
+	var arr [3]int8
+	if err := ToGo(eval(`[1, 2]`), &arr); err != nil {
+		t.Fatal(err)
+	}
+	if arr != [3]int8{1, 2, 0} {
+		t.Errorf("wrong array. got=%v", arr)
+	}
+
+	var ptr *int
+	if err := ToGo(eval(`5`), &ptr); err != nil || ptr == nil || *ptr != 5 {
+		t.Errorf("wrong pointer. got=%v (%v)", ptr, err)
+	}
+
+	var fs []float32
+	if err := ToGo(eval(`[1.5, 2]`), &fs); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fs, []float32{1.5, 2}) {
+		t.Errorf("wrong floats. got=%v", fs)
+	}
+
+	var native any
+	if err := ToGo(eval(`{"a": [1, "b", true, 0.5, fn(){}()]}`), &native); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(native, map[string]any{"a": []any{1, "b", true, 0.5, nil}}) {
+		t.Errorf("wrong native value. got=%#v", native)
+	}
+	if err := ToGo(eval(`{1: "a"}`), &native); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(native, map[any]any{1: "a"}) {
+		t.Errorf("wrong native value. got=%#v", native)
+	}
+
+	var n big.Int
+	if err := ToGo(eval(`18446744073709551616`), &n); err != nil || n.String() != "18446744073709551616" {
+		t.Errorf("wrong big integer. got=%s (%v)", &n, err)
+	}
+	var np *big.Int
+	if err := ToGo(eval(`-3`), &np); err != nil || np == nil || np.Int64() != -3 {
+		t.Errorf("wrong big integer pointer. got=%v (%v)", np, err)
+	}
+
+	var obj Object
+	if err := ToGo(eval(`"s"`), &obj); err != nil || obj.Inspect() != `"s"` {
+		t.Errorf("wrong object. got=%v (%v)", obj, err)
+	}
+}
+
+func TestToGo_errors(t *testing.T) {
+	var item marshalItem
+	var small int8
+	var u uint
+	var arr [1]int
+	var f32 float32
+	var f float64
+	var n big.Int
+	tests := []struct {
+		input  string
+		target any
+		path   string
+	}{
+		{`{"name": 1}`, &item, "name"},
+		{`{"Tags": ["a", 2]}`, &item, "Tags[1]"},
+		{`300`, &small, ""},
+		{`-1`, &u, ""},
+		{`[1, 2]`, &arr, ""},
+		{`"a"`, &arr, ""},
+		{`1e300`, &f32, ""},
+		{`"1.5"`, &f, ""},
+		{`1.5`, &n, ""},
+	}
+	for _, tt := range tests {
+		err := ToGo(testEval(tt.input), tt.target)
+		var terr *UnmarshalTypeError
+		if !errors.As(err, &terr) {
+			t.Errorf("%s: wrong error. got=%T (%v)", tt.input, err, err)
+			continue
+		}
+		if terr.Path != tt.path {
+			t.Errorf("%s: wrong path. want=%q got=%q", tt.input, tt.path, terr.Path)
+		}
+	}
+
+	var ierr *InvalidTargetError
+	if err := ToGo(testEval(`1`), item); !errors.As(err, &ierr) {
+		t.Errorf("wrong error for non pointer target. got=%T (%v)", err, err)
+	}
+	if err := ToGo(testEval(`1`), nil); !errors.As(err, &ierr) {
+		t.Errorf("wrong error for nil target. got=%T (%v)", err, err)
+	}
+}
@@ -3,6 +3,9 @@ package interp
 import (
 	"fmt"
 	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -10,9 +13,11 @@ type ObjectType string
 
 const (
 	IntegerType    = "INTEGER"
+	FloatType      = "FLOAT"
 	BooleanType    = "BOOLEAN"
 	NullType       = "NULL"
 	RetType        = "RETURN"
+	LoopType       = "LOOP_CONTROL"
 	ErrorType      = "ERROR"
 	FunctionType   = "FUNCTION"
 	IdentifierType = "IDENTIFIER"
@@ -26,6 +31,33 @@ const (
 	MacroType      = "MACRO"
 )
 
+// ErrorKind classifies the errors raised while running a program so the
+// embedder can tell them apart without matching the message.
+type ErrorKind string
+
+const (
+	KindTypeMismatch   ErrorKind = "TYPE_MISMATCH"
+	KindArity          ErrorKind = "ARITY"
+	KindStackUnderflow ErrorKind = "STACK_UNDERFLOW"
+	KindDivisionByZero ErrorKind = "DIVISION_BY_ZERO"
+	KindUnhashableKey  ErrorKind = "UNHASHABLE_KEY"
+	KindInternal       ErrorKind = "INTERNAL"
+	KindUndefined      ErrorKind = "UNDEFINED"
+	KindThrown         ErrorKind = "THROWN"
+	KindBudgetExceeded ErrorKind = "BUDGET_EXCEEDED"
+	KindCancelled      ErrorKind = "CANCELLED"
+	KindStackOverflow  ErrorKind = "STACK_OVERFLOW"
+	// KindInvalidOperand is an operand of the right type but out of the
+	// operator's domain, e.g. a negative shift count.
+	KindInvalidOperand ErrorKind = "INVALID_OPERAND"
+)
+
+// Catchable reports whether a script try block may handle errors of kind.
+// Running out of budget or being cancelled always stops the script.
+func (k ErrorKind) Catchable() bool {
+	return k != KindBudgetExceeded && k != KindCancelled
+}
+
 type Object interface {
 	Type() ObjectType
 	Inspect() string
@@ -43,6 +75,55 @@ type Integer struct {
 
 func (*Integer) Type() ObjectType { return IntegerType }
 
+type Float struct {
+	Primitive[float64]
+}
+
+func (*Float) Type() ObjectType { return FloatType }
+
+// Inspect always shows a decimal point or an exponent so a float does not
+// read as an integer.
+func (f *Float) Inspect() string { return formatFloat(f.Value) }
+
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if strings.ContainsAny(s, ".eIN") {
+		return s
+	}
+	return s + ".0"
+}
+
+// FloatOperands returns left and right as floats when both are numbers and
+// at least one of them is a Float, the integer being promoted.
+func FloatOperands(left, right Object) (l, r float64, ok bool) {
+	l, lok := toFloat(left)
+	r, rok := toFloat(right)
+	_, lflt := left.(*Float)
+	_, rflt := right.(*Float)
+	return l, r, lok && rok && (lflt || rflt)
+}
+
+func toFloat(o Object) (float64, bool) {
+	switch n := o.(type) {
+	case *Integer:
+		return float64(n.Value), true
+	case *BigInteger:
+		return bigToFloat(n.Value), true
+	case *Float:
+		return n.Value, true
+	}
+	return 0, false
+}
+
+// floatToInt returns the integer part of f, ok is false when it is not a
+// number or does not fit an int.
+func floatToInt(f float64) (i int, ok bool) {
+	if math.IsNaN(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int(f), true
+}
+
 type Boolean struct {
 	Primitive[bool]
 }
@@ -61,14 +142,62 @@ type ReturnValue struct {
 
 func (*ReturnValue) Type() ObjectType { return RetType }
 
+// LoopControl is what break and continue evaluate to, it ends the blocks
+// up to the innermost loop like ReturnValue does up to the function.
+type LoopControl struct {
+	Break bool
+}
+
+func (*LoopControl) Type() ObjectType { return LoopType }
+func (l *LoopControl) Inspect() string {
+	if l.Break {
+		return "break"
+	}
+	return "continue"
+}
+
 type Error struct {
-	Msg string
+	Msg  string
+	Kind ErrorKind
+	// Value is the object passed to throw.
+	Value Object
+	// Trace is the chain of calls, innermost first, for a stack overflow.
+	Trace []TraceFrame
+}
+
+// TraceFrame is a function call active when an error happened, Line and
+// Column being where that function was executing.
+type TraceFrame struct {
+	Function     string
+	Line, Column int
+}
+
+func (t TraceFrame) String() string {
+	return fmt.Sprintf("%s (%d:%d)", t.Function, t.Line, t.Column)
 }
 
 func (*Error) Type() ObjectType  { return ErrorType }
 func (e *Error) Inspect() string { return fmt.Sprintf("ERROR: %s", e.Msg) }
+func (e *Error) Error() string   { return e.Msg }
+
+// ToHash returns the value bound to the catch parameter, a hash with the
+// "message" and "kind" of the error and the thrown "value" if any.
+func (e *Error) ToHash() *Hash {
+	h := &Hash{Pairs: map[HashKey]HashPair{}}
+	set := func(key string, val Object) {
+		k := &String{Primitive[string]{key}}
+		h.Pairs[k.HashKey()] = HashPair{k, val}
+	}
+	set("message", &String{Primitive[string]{e.Msg}})
+	set("kind", &String{Primitive[string]{string(e.Kind)}})
+	if e.Value != nil {
+		set("value", e.Value)
+	}
+	return h
+}
 
 type Function struct {
+	Name       string
 	Parameters []*Identifier
 	Body       *BlockStatement
 	Env        *Environment
@@ -145,6 +274,15 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{i.Type(), uint64(i.Value)}
 }
 
+// HashKey of a float holding a whole number is the one of that integer,
+// so 1.0 and 1 are the same key as they are equal.
+func (f *Float) HashKey() HashKey {
+	if i, ok := floatToInt(f.Value); ok && float64(i) == f.Value {
+		return (&Integer{Primitive[int]{i}}).HashKey()
+	}
+	return HashKey{f.Type(), math.Float64bits(f.Value)}
+}
+
 func (s *String) HashKey() HashKey {
 	hh := fnv.New64a()
 	hh.Write([]byte(s.Value))
@@ -168,6 +306,8 @@ func (h *Hash) Inspect() string {
 		p[count] = fmt.Sprintf("%s:%s", kv.Key.Inspect(), kv.Value.Inspect())
 		count++
 	}
+	// sorted so the same hash always prints the same
+	sort.Strings(p)
 	return fmt.Sprintf("{%s}", strings.Join(p, ","))
 }
 
@@ -199,3 +339,75 @@ func (m *MacroObj) Inspect() string {
 	return fmt.Sprintf("fn (%s) {\n%s\n}", strings.Join(prm, ", "), m.Body)
 
 }
+
+// Equal compares numbers, booleans, strings, arrays and hashes by value,
+// other objects by identity. NaN is equal to nothing, not even itself.
+func Equal(a, b Object) bool {
+	if l, r, ok := FloatOperands(a, b); ok {
+		return l == r
+	}
+	if a == b {
+		return true
+	}
+	if l, r, ok := IntOperands(a, b); ok {
+		return l.Cmp(r) == 0
+	}
+	if a == nil || b == nil || a.Type() != b.Type() {
+		return false
+	}
+	switch l := a.(type) {
+	case *Integer:
+		return l.Value == b.(*Integer).Value
+	case *Float:
+		return l.Value == b.(*Float).Value
+	case *Boolean:
+		return l.Value == b.(*Boolean).Value
+	case *String:
+		return l.Value == b.(*String).Value
+	case *Null:
+		return true
+	case *SliceObj:
+		r := b.(*SliceObj)
+		if len(l.Elements) != len(r.Elements) {
+			return false
+		}
+		for i, e := range l.Elements {
+			if !Equal(e, r.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		r := b.(*Hash)
+		if len(l.Pairs) != len(r.Pairs) {
+			return false
+		}
+		for k, lp := range l.Pairs {
+			rp, ok := r.Pairs[k]
+			if !ok || !Equal(lp.Value, rp.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// IsTruthy reports whether o counts as true in a condition: false, null
+// and zero are falsy, everything else is truthy.
+func IsTruthy(o Object) bool {
+	switch b := o.(type) {
+	case *Boolean:
+		return b.Value
+	case *Integer:
+		return b.Value != 0
+	case *Float:
+		return b.Value != 0
+	case *BigInteger:
+		return b.Value.Sign() != 0
+	case *Null:
+		return false
+	default:
+		return o != nil
+	}
+}
@@ -1,18 +1,24 @@
 package interp
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 )
 
 const (
 	_ uint8 = iota
 	Lowest
+	Assignment
+	LogicalOr
+	LogicalAnd
 	Equals
 	Lessgreater
 	Sum
 	Product
 	Prefix
+	Exponent
 	Call
 	Index
 )
@@ -28,21 +34,45 @@ type Parser struct {
 
 	prefixs map[TokenType]prefixParseFn
 	infixs  map[TokenType]infixParseFn
+	// loopDepth is how many loops the current token is in, within the
+	// innermost function.
+	loopDepth int
 }
 
 var precedences = map[TokenType]uint8{
-	Eq:       Equals,
-	Neq:      Equals,
-	Lt:       Lessgreater,
-	Gt:       Lessgreater,
-	Lte:      Lessgreater,
-	Gte:      Lessgreater,
-	Plus:     Sum,
-	Minus:    Sum,
-	Slash:    Product,
-	Star:     Product,
-	Lparen:   Call,
-	Lbracket: Index,
+	Assign:        Assignment,
+	PlusAssign:    Assignment,
+	MinusAssign:   Assignment,
+	StarAssign:    Assignment,
+	SlashAssign:   Assignment,
+	PercentAssign: Assignment,
+	PowAssign:     Assignment,
+	AmpAssign:     Assignment,
+	PipeAssign:    Assignment,
+	CaretAssign:   Assignment,
+	ShlAssign:     Assignment,
+	ShrAssign:     Assignment,
+	Or:            LogicalOr,
+	And:           LogicalAnd,
+	Eq:            Equals,
+	Neq:           Equals,
+	Lt:            Lessgreater,
+	Gt:            Lessgreater,
+	Lte:           Lessgreater,
+	Gte:           Lessgreater,
+	Plus:          Sum,
+	Minus:         Sum,
+	Pipe:          Sum,
+	Caret:         Sum,
+	Slash:         Product,
+	Star:          Product,
+	Percent:       Product,
+	Amp:           Product,
+	Shl:           Product,
+	Shr:           Product,
+	Pow:           Exponent,
+	Lparen:        Call,
+	Lbracket:      Index,
 }
 
 func NewParser(l *Lexer) *Parser {
@@ -50,8 +80,10 @@ func NewParser(l *Lexer) *Parser {
 	p.prefixs = map[TokenType]prefixParseFn{}
 	p.prefixs[Ident] = p.parseIdentifier
 	p.prefixs[Int] = p.parseIntLiteral
+	p.prefixs[Flt] = p.parseFloatLiteral
 	p.prefixs[Bang] = p.parsePrefixExpression
 	p.prefixs[Minus] = p.parsePrefixExpression
+	p.prefixs[Tilde] = p.parsePrefixExpression
 	p.prefixs[True] = p.parseBoolean
 	p.prefixs[False] = p.parseBoolean
 	p.prefixs[Lparen] = p.parseGroupExpression
@@ -61,6 +93,9 @@ func NewParser(l *Lexer) *Parser {
 	p.prefixs[Lbracket] = p.parseSlice
 	p.prefixs[Lbrace] = p.parseHashMap
 	p.prefixs[Macro] = p.parseMacroLiteral
+	p.prefixs[Try] = p.parseTryExpression
+	p.prefixs[While] = p.parseWhileExpression
+	p.prefixs[For] = p.parseForExpression
 	p.infixs = map[TokenType]infixParseFn{}
 	p.infixs[Plus] = p.parseInfixExpression
 	p.infixs[Minus] = p.parseInfixExpression
@@ -72,6 +107,19 @@ func NewParser(l *Lexer) *Parser {
 	p.infixs[Neq] = p.parseInfixExpression
 	p.infixs[Gte] = p.parseInfixExpression
 	p.infixs[Lte] = p.parseInfixExpression
+	p.infixs[Percent] = p.parseInfixExpression
+	p.infixs[Amp] = p.parseInfixExpression
+	p.infixs[Pipe] = p.parseInfixExpression
+	p.infixs[Caret] = p.parseInfixExpression
+	p.infixs[Shl] = p.parseInfixExpression
+	p.infixs[Shr] = p.parseInfixExpression
+	p.infixs[Pow] = p.parseInfixExpression
+	p.infixs[And] = p.parseInfixExpression
+	p.infixs[Or] = p.parseInfixExpression
+	for _, t := range []TokenType{Assign, PlusAssign, MinusAssign, StarAssign, SlashAssign,
+		PercentAssign, PowAssign, AmpAssign, PipeAssign, CaretAssign, ShlAssign, ShrAssign} {
+		p.infixs[t] = p.parseAssignExpression
+	}
 	p.infixs[Lparen] = p.parseCallExpression
 	p.infixs[Lbracket] = p.parseIndexing
 	p.nextToken()
@@ -108,6 +156,8 @@ func (p *Parser) parseStatement() Statement {
 		return p.parseLetStatement()
 	case Return:
 		return p.parseReturnStatement()
+	case Break, Continue:
+		return p.parseLoopControl()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -152,6 +202,21 @@ func (p *Parser) parseReturnStatement() *ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseLoopControl() Statement {
+	tok := p.currToken
+	if p.peekToken.Type == Semicolon {
+		p.nextToken()
+	}
+	if p.loopDepth == 0 {
+		p.errors = append(p.errors, fmt.Sprintf("%s outside of a loop", tok.Literal))
+		return nil
+	}
+	if tok.Type == Break {
+		return &BreakStatement{Token: tok}
+	}
+	return &ContinueStatement{Token: tok}
+}
+
 func (p *Parser) parseExpressionStatement() *ExpressionStatement {
 	stmt := &ExpressionStatement{Token: p.currToken}
 	stmt.Expression = p.parseExpression(Lowest)
@@ -187,6 +252,11 @@ func (p *Parser) parseIdentifier() Expression {
 func (p *Parser) parseIntLiteral() Expression {
 	lit := &IntLiteral{Token: p.currToken}
 	value, err := strconv.Atoi(p.currToken.Literal)
+	if errors.Is(err, strconv.ErrRange) {
+		if b, ok := new(big.Int).SetString(p.currToken.Literal, 10); ok {
+			return &BigIntLiteral{Token: p.currToken, Value: b}
+		}
+	}
 	if err != nil {
 		msg := fmt.Sprintf("cannot parse %q as integer", p.currToken.Literal)
 		p.errors = append(p.errors, msg)
@@ -196,6 +266,18 @@ func (p *Parser) parseIntLiteral() Expression {
 	return lit
 }
 
+func (p *Parser) parseFloatLiteral() Expression {
+	lit := &FloatLiteral{Token: p.currToken}
+	value, err := strconv.ParseFloat(p.currToken.Literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("cannot parse %q as float", p.currToken.Literal)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	lit.Value = value
+	return lit
+}
+
 func (p *Parser) parsePrefixExpression() Expression {
 	exp := &PrefixExpression{
 		Token:    p.currToken,
@@ -227,11 +309,29 @@ func (p *Parser) parseInfixExpression(left Expression) Expression {
 		Operator: p.currToken.Literal,
 	}
 	pred := p.currPrecedence()
+	if e.Token.Type == Pow {
+		// right associative, 2 ** 3 ** 2 is 2 ** (3 ** 2)
+		pred--
+	}
 	p.nextToken()
 	e.Right = p.parseExpression(pred)
 	return e
 }
 
+// parseAssignExpression parses an assignment to the identifier left. It is
+// right associative, a = b = 1 assigns 1 to both.
+func (p *Parser) parseAssignExpression(left Expression) Expression {
+	name, ok := left.(*Identifier)
+	if !ok {
+		p.errors = append(p.errors, fmt.Sprintf("cannot assign to %s", left))
+		return nil
+	}
+	e := &AssignExpression{Token: p.currToken, Name: name, Operator: p.currToken.Literal}
+	p.nextToken()
+	e.Value = p.parseExpression(Assignment - 1)
+	return e
+}
+
 func (p *Parser) parseBoolean() Expression {
 	return &BooleanLiteral{p.currToken, p.currToken.Type == True}
 }
@@ -269,6 +369,88 @@ func (p *Parser) parseIfExpression() Expression {
 	return ifexp
 }
 
+func (p *Parser) parseWhileExpression() Expression {
+	we := &WhileExpression{Token: p.currToken}
+	if !p.expectNext(Lparen) {
+		return nil
+	}
+	p.nextToken()
+	we.Condition = p.parseExpression(Lowest)
+	if !p.expectNext(Rparen) {
+		return nil
+	}
+	if !p.expectNext(Lbrace) {
+		return nil
+	}
+	we.Body = p.parseLoopBody()
+	return we
+}
+
+func (p *Parser) parseForExpression() Expression {
+	fe := &ForExpression{Token: p.currToken}
+	if !p.expectNext(Lparen) {
+		return nil
+	}
+	p.nextToken()
+	if p.currToken.Type != Semicolon {
+		fe.Init = p.parseStatement()
+		if p.currToken.Type != Semicolon && !p.expectNext(Semicolon) {
+			return nil
+		}
+	}
+	p.nextToken()
+	if p.currToken.Type != Semicolon {
+		fe.Condition = p.parseExpression(Lowest)
+		if !p.expectNext(Semicolon) {
+			return nil
+		}
+	}
+	p.nextToken()
+	if p.currToken.Type != Rparen {
+		fe.Post = p.parseStatement()
+		if !p.expectNext(Rparen) {
+			return nil
+		}
+	}
+	if !p.expectNext(Lbrace) {
+		return nil
+	}
+	fe.Body = p.parseLoopBody()
+	return fe
+}
+
+func (p *Parser) parseLoopBody() *BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseTryExpression() Expression {
+	te := &TryExpression{Token: p.currToken}
+	if !p.expectNext(Lbrace) {
+		return nil
+	}
+	te.Body = p.parseBlockStatement()
+	if !p.expectNext(Catch) {
+		return nil
+	}
+	if !p.expectNext(Lparen) {
+		return nil
+	}
+	if !p.expectNext(Ident) {
+		return nil
+	}
+	te.Param = &Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	if !p.expectNext(Rparen) {
+		return nil
+	}
+	if !p.expectNext(Lbrace) {
+		return nil
+	}
+	te.Catch = p.parseBlockStatement()
+	return te
+}
+
 func (p *Parser) parseBlockStatement() *BlockStatement {
 	b := &BlockStatement{Token: p.currToken}
 	b.Statements = []Statement{}
@@ -297,7 +479,11 @@ func (p *Parser) parseFuncLiteral() Expression {
 	if !p.expectNext(Lbrace) {
 		return nil
 	}
+	// a function body starts outside of any loop
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
 	fn.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 	return fn
 }
 
@@ -158,6 +158,33 @@ func TestIntLiteralExpression(t *testing.T) {
 	testIntLiteral(t, stmt.Expression, expected)
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9", 1e-9},
+		{"2.5E+3", 2500},
+	}
+	for _, tt := range tests {
+		p := NewParser(NewLexer(tt.input))
+		prog := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt, ok := prog.Statements[0].(*ExpressionStatement)
+		if !ok {
+			t.Fatalf("stmt is not expression statement. got=%T", prog.Statements[0])
+		}
+		lit, ok := stmt.Expression.(*FloatLiteral)
+		if !ok {
+			t.Fatalf("exp is not *FloatLiteral. got=%T", stmt.Expression)
+		}
+		if lit.Value != tt.expected {
+			t.Errorf("wrong value. want=%g got=%g", tt.expected, lit.Value)
+		}
+	}
+}
+
 func TestParsingPrefixExpression(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -288,6 +315,21 @@ func TestOperatorPrecedence(t *testing.T) {
 		{"add(a + b + c * d / f + g)",
 			"add((((a+b)+((c*d)/f))+g))"},
 		{"a + add(b * c) + d - e [f / g]", "(((a+add((b*c)))+d)-e[(f/g)])"},
+		{"a % b * c", "((a%b)*c)"},
+		{"a + b % c", "(a+(b%c))"},
+		{"a ** b ** c", "(a**(b**c))"},
+		{"-a ** b", "(-(a**b))"},
+		{"a * b ** c", "(a*(b**c))"},
+		{"a | b & c", "(a|(b&c))"},
+		{"a ^ b | c", "((a^b)|c)"},
+		{"a + b << c", "(a+(b<<c))"},
+		{"a >> b == c", "((a>>b)==c)"},
+		{"~a & b", "((~a)&b)"},
+		{"a || b && c", "(a||(b&&c))"},
+		{"a && b || c", "((a&&b)||c)"},
+		{"a == b && c != d", "((a==b)&&(c!=d))"},
+		{"a < b || !c", "((a<b)||(!c))"},
+		{"a & b && c | d", "((a&b)&&(c|d))"},
 	}
 	for _, tt := range tests {
 		p := NewParser(NewLexer(tt.input))
@@ -768,3 +810,119 @@ func TestMacroLiteralParsing(t *testing.T) {
 	}
 	testInfixExpression(t, body.Expression, "x", "+", "y")
 }
+
+func TestTryExpressionParsing(t *testing.T) {
+	input := "try { x + y; } catch (err) { err }"
+	p := NewParser(NewLexer(input))
+	prog := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(prog.Statements) != 1 {
+		t.Fatalf("prog stmt expected 1. got=%d", len(prog.Statements))
+	}
+	stmt, ok := prog.Statements[0].(*ExpressionStatement)
+	if !ok {
+		t.Fatalf("'%s' is not expression stmt. got=%T",
+			prog.Statements[0], prog.Statements[0])
+	}
+	try, ok := stmt.Expression.(*TryExpression)
+	if !ok {
+		t.Fatalf("'%s' is not try expression. got=%T", stmt.Expression, stmt.Expression)
+	}
+	body, ok := try.Body.Statements[0].(*ExpressionStatement)
+	if !ok {
+		t.Fatalf("try body stmt is not expr stmt. got=%T", try.Body.Statements[0])
+	}
+	testInfixExpression(t, body.Expression, "x", "+", "y")
+	testLiteralExpression(t, try.Param, "err")
+	catch, ok := try.Catch.Statements[0].(*ExpressionStatement)
+	if !ok {
+		t.Fatalf("catch stmt is not expr stmt. got=%T", try.Catch.Statements[0])
+	}
+	testLiteralExpression(t, catch.Expression, "err")
+}
+
+func TestTryExpressionParsing_errors(t *testing.T) {
+	tests := []string{
+		"try { 1 }",
+		"try { 1 } catch { 2 }",
+		"try { 1 } catch (1) { 2 }",
+	}
+	for _, input := range tests {
+		p := NewParser(NewLexer(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors", input)
+		}
+	}
+}
+
+func TestLoopParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x < 10) { x; }", "while (x<10) x"},
+		{"for (let i = 0; i < n; let i = i + 1) { i }", "for (let i = 0; (i<n); let i = (i+1)) i"},
+		{"for (;;) { break; }", "for (; ; ) break;"},
+		{"for (0; true;) { continue }", "for (0; true; ) continue;"},
+		{"while (true) { if (x) { break } }", "while true if x break;"},
+	}
+	for _, tt := range tests {
+		p := NewParser(NewLexer(tt.input))
+		prog := p.ParseProgram()
+		checkParserErrors(t, p)
+		if len(prog.Statements) != 1 {
+			t.Fatalf("%s: prog stmt expected 1. got=%d", tt.input, len(prog.Statements))
+		}
+		if got := prog.String(); got != tt.expected {
+			t.Errorf("%s: wrong program. want=%q got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestLoopParsing_errors(t *testing.T) {
+	tests := []string{
+		"break",
+		"if (true) { continue }",
+		"while (true) { fn() { break } }",
+		"while true { 1 }",
+		"for (let i = 0; i < 1) { 1 }",
+	}
+	for _, input := range tests {
+		p := NewParser(NewLexer(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors", input)
+		}
+	}
+}
+
+func TestAssignExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5", "(x=5)"},
+		{"x += 1 * 2", "(x+=(1*2))"},
+		{"a = b **= 2", "(a=(b**=2))"},
+		{"x = y || z", "(x=(y||z))"},
+		{"let x = y = 1;", "let x = (y=1);"},
+		{"f(x = 1)", "f((x=1))"},
+	}
+	for _, tt := range tests {
+		p := NewParser(NewLexer(tt.input))
+		prog := p.ParseProgram()
+		checkParserErrors(t, p)
+		if got := prog.String(); got != tt.expected {
+			t.Errorf("%s: wrong program. want=%q got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	for _, input := range []string{"1 = 2", "f() += 1", "a[0] = 1"} {
+		p := NewParser(NewLexer(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors", input)
+		}
+	}
+}
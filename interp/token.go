@@ -43,6 +43,34 @@ const (
 	Rbracket
 	Colon
 	Macro
+	Try
+	Catch
+	Percent
+	Pow
+	Amp
+	Pipe
+	Caret
+	Shl
+	Shr
+	Tilde
+	And
+	Or
+	Flt
+	While
+	For
+	Break
+	Continue
+	PlusAssign
+	MinusAssign
+	StarAssign
+	SlashAssign
+	PercentAssign
+	PowAssign
+	AmpAssign
+	PipeAssign
+	CaretAssign
+	ShlAssign
+	ShrAssign
 )
 
 func (t TokenType) String() string {
@@ -51,36 +79,64 @@ func (t TokenType) String() string {
 }
 
 var mapTokenDisplay = map[TokenType]string{
-	Assign:    "=",
-	Plus:      "+",
-	Lparen:    "(",
-	Rparen:    ")",
-	Lbrace:    "{",
-	Rbrace:    "}",
-	Comma:     ",",
-	Semicolon: ";",
-	Let:       "let",
-	Fn:        "fn",
-	Bang:      "!",
-	Star:      "*",
-	Slash:     "/",
-	Gt:        ">",
-	Lt:        "<",
-	Minus:     "-",
-	Return:    "return",
-	If:        "if",
-	Else:      "else",
-	True:      "true",
-	False:     "false",
-	Neq:       "!=",
-	Gte:       ">=",
-	Lte:       "<=",
-	Eq:        "==",
-	Ident:     "Ident",
-	Int:       "Int",
-	Str:       "String",
-	Lbracket:  "[",
-	Rbracket:  "]",
-	Colon:     ":",
-	Macro:     "macro",
+	Assign:        "=",
+	Plus:          "+",
+	Lparen:        "(",
+	Rparen:        ")",
+	Lbrace:        "{",
+	Rbrace:        "}",
+	Comma:         ",",
+	Semicolon:     ";",
+	Let:           "let",
+	Fn:            "fn",
+	Bang:          "!",
+	Star:          "*",
+	Slash:         "/",
+	Gt:            ">",
+	Lt:            "<",
+	Minus:         "-",
+	Return:        "return",
+	If:            "if",
+	Else:          "else",
+	True:          "true",
+	False:         "false",
+	Neq:           "!=",
+	Gte:           ">=",
+	Lte:           "<=",
+	Eq:            "==",
+	Ident:         "Ident",
+	Int:           "Int",
+	Flt:           "Float",
+	While:         "while",
+	For:           "for",
+	Break:         "break",
+	Continue:      "continue",
+	Str:           "String",
+	Lbracket:      "[",
+	Rbracket:      "]",
+	Colon:         ":",
+	Macro:         "macro",
+	Try:           "try",
+	Catch:         "catch",
+	Percent:       "%",
+	Pow:           "**",
+	Amp:           "&",
+	Pipe:          "|",
+	Caret:         "^",
+	Shl:           "<<",
+	Shr:           ">>",
+	Tilde:         "~",
+	And:           "&&",
+	Or:            "||",
+	PlusAssign:    "+=",
+	MinusAssign:   "-=",
+	StarAssign:    "*=",
+	SlashAssign:   "/=",
+	PercentAssign: "%=",
+	PowAssign:     "**=",
+	AmpAssign:     "&=",
+	PipeAssign:    "|=",
+	CaretAssign:   "^=",
+	ShlAssign:     "<<=",
+	ShrAssign:     ">>=",
 }
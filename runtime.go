@@ -0,0 +1,252 @@
+// Package compgo is the embedding API over the interpreter and the
+// bytecode VM.
+package compgo
+
+import (
+	"compgo/comp"
+	"compgo/interp"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Engine selects how a Runtime executes scripts.
+type Engine int
+
+const (
+	// VM compiles scripts to bytecode and runs them on comp.Vm.
+	VM Engine = iota
+	// Interpreter evaluates the AST with interp.Eval.
+	Interpreter
+)
+
+func (e Engine) String() string {
+	switch e {
+	case VM:
+		return "vm"
+	case Interpreter:
+		return "interpreter"
+	}
+	return fmt.Sprintf("Engine(%d)", int(e))
+}
+
+// ParseError holds the parser errors of a script.
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "parse error: " + strings.Join(e.Errors, "; ")
+}
+
+// KindOf returns the kind of a script error returned by either engine, or
+// an empty kind for other errors.
+func KindOf(err error) interp.ErrorKind {
+	var rerr *comp.RuntimeError
+	if errors.As(err, &rerr) {
+		return rerr.Kind
+	}
+	var ierr *interp.Error
+	if errors.As(err, &ierr) {
+		return ierr.Kind
+	}
+	return ""
+}
+
+// Runtime runs scripts on one engine and keeps their globals and macros
+// from one call to the next.
+type Runtime struct {
+	engine  Engine
+	macros  *interp.Environment
+	collate bool
+	bigInt  bool
+
+	// Interpreter state
+	env *interp.Environment
+
+	// VM state
+	builtins  *comp.Registry
+	symbols   *comp.SymbolTable
+	compiler  *comp.Compiler
+	constants []interp.Object
+	globals   []interp.Object
+}
+
+// New returns a runtime executing scripts with engine.
+func New(engine Engine) *Runtime {
+	r := &Runtime{engine: engine, macros: interp.NewEnvironment()}
+	switch engine {
+	case Interpreter:
+		r.env = interp.NewEnvironment()
+	default:
+		r.engine = VM
+		r.builtins = comp.NewRegistry()
+		r.symbols = comp.NewSymbolTable()
+		r.builtins.Define(r.symbols)
+		r.compiler = comp.NewWithRegistry(r.builtins)
+		r.compiler.SetSymbolTable(r.symbols)
+		r.constants = []interp.Object{}
+		r.globals = make([]interp.Object, comp.GlobalSize)
+	}
+	return r
+}
+
+func (r *Runtime) Engine() Engine { return r.engine }
+
+// Eval runs src and returns the value of its last expression. Script
+// errors are *interp.Error or *comp.RuntimeError, depending on the engine.
+func (r *Runtime) Eval(src string) (interp.Object, error) {
+	p := interp.NewParser(interp.NewLexer(src))
+	prg := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{p.Errors()}
+	}
+	interp.DefineMacros(prg, r.macros)
+	node := interp.ExpandMacros(prg, r.macros)
+	if r.engine == Interpreter {
+		return result(interp.EvalWithOptions(node, r.env, r.evalOptions()))
+	}
+	// a failed script leaves no symbols defined without their value
+	restore := r.compiler.Snapshot()
+	if err := r.compiler.Compile(node); err != nil {
+		restore()
+		return nil, err
+	}
+	b := r.compiler.Bytecode()
+	vm := comp.NewVm(b)
+	vm.SetGlobals(r.globals)
+	vm.SetCollate(r.collate)
+	vm.SetBigInt(r.bigInt)
+	if err := vm.Run(); err != nil {
+		restore()
+		return nil, err
+	}
+	r.constants = b.Constants
+	if !endsWithExpression(node) {
+		// like the interpreter, rather than the value popped by a let
+		return interp.NullObject, nil
+	}
+	return result(vm.LastPop())
+}
+
+func endsWithExpression(node interp.Node) bool {
+	prg, ok := node.(*interp.Program)
+	if !ok || len(prg.Statements) == 0 {
+		return false
+	}
+	_, ok = prg.Statements[len(prg.Statements)-1].(*interp.ExpressionStatement)
+	return ok
+}
+
+// Call calls the global function or builtin name with args.
+func (r *Runtime) Call(name string, args ...interp.Object) (interp.Object, error) {
+	fn, ok := r.GetGlobal(name)
+	if !ok {
+		return nil, fmt.Errorf("undefined function: %s", name)
+	}
+	if r.engine == Interpreter {
+		return result(interp.ApplyWithOptions(fn, r.evalOptions(), args...))
+	}
+	vm := comp.NewVm(&comp.Bytecode{Constants: r.constants, Builtins: r.builtins})
+	vm.SetGlobals(r.globals)
+	vm.SetCollate(r.collate)
+	vm.SetBigInt(r.bigInt)
+	obj, err := vm.Call(fn, args...)
+	if err != nil {
+		return nil, err
+	}
+	return result(obj)
+}
+
+// SetCollate makes the ordering operators and the compare builtin order
+// strings with interp.Collate instead of by code point.
+func (r *Runtime) SetCollate(on bool) {
+	r.collate = on
+	compare := interp.Builtins["compare"].Fn
+	if on {
+		compare = interp.CollatedCompare
+	}
+	// replacing a builtin never fails
+	r.RegisterBuiltin("compare", compare)
+}
+
+// SetBigInt makes integer arithmetic overflowing an int give an
+// interp.BigInteger instead of wrapping around.
+func (r *Runtime) SetBigInt(on bool) {
+	r.bigInt = on
+}
+
+func (r *Runtime) evalOptions() interp.EvalOptions {
+	return interp.EvalOptions{Collate: r.collate, BigInt: r.bigInt}
+}
+
+// SetGlobal binds name to val, converted with interp.FromGoWithOptions, as
+// if the script defined it with let.
+func (r *Runtime) SetGlobal(name string, val any) error {
+	obj, err := interp.FromGoWithOptions(val, r.evalOptions())
+	if err != nil {
+		return err
+	}
+	if r.engine == Interpreter {
+		r.env.Set(name, obj)
+		return nil
+	}
+	sym, ok := r.symbols.Resolve(name)
+	if !ok || sym.Scope != comp.GlobalScope {
+		sym = r.symbols.Define(name)
+	}
+	if sym.Index >= len(r.globals) {
+		return fmt.Errorf("too many globals: %d", sym.Index+1)
+	}
+	r.globals[sym.Index] = obj
+	return nil
+}
+
+// GetGlobal returns the value of the global name, which may also be a
+// builtin.
+func (r *Runtime) GetGlobal(name string) (interp.Object, bool) {
+	if r.engine == Interpreter {
+		if obj, ok := r.env.Get(name); ok {
+			return obj, true
+		}
+		return r.env.Builtin(name)
+	}
+	sym, ok := r.symbols.Resolve(name)
+	if !ok {
+		return nil, false
+	}
+	switch sym.Scope {
+	case comp.GlobalScope:
+		obj := r.globals[sym.Index]
+		return obj, obj != nil
+	case comp.BuiltinScope:
+		return r.builtins.Builtin(sym.Index), true
+	}
+	return nil, false
+}
+
+// RegisterBuiltin makes fn callable as name by the scripts run afterwards.
+func (r *Runtime) RegisterBuiltin(name string, fn interp.BuiltinFunction) error {
+	if r.engine == Interpreter {
+		r.env.RegisterBuiltin(name, fn)
+		return nil
+	}
+	idx, err := r.builtins.Register(name, fn)
+	if err != nil {
+		return err
+	}
+	r.symbols.DefineBuiltin(idx, name)
+	return nil
+}
+
+// result converts the object a script evaluated to into the values
+// returned by Runtime, error objects becoming errors.
+func result(obj interp.Object) (interp.Object, error) {
+	switch o := obj.(type) {
+	case nil:
+		return interp.NullObject, nil
+	case *interp.Error:
+		return nil, o
+	}
+	return obj, nil
+}
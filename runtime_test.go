@@ -0,0 +1,225 @@
+package compgo
+
+import (
+	"compgo/interp"
+	"errors"
+	"testing"
+)
+
+var engines = []Engine{VM, Interpreter}
+
+func mustEval(t *testing.T, r *Runtime, src string) interp.Object {
+	t.Helper()
+	obj, err := r.Eval(src)
+	if err != nil {
+		t.Fatalf("%s: eval %q: %s", r.Engine(), src, err)
+	}
+	return obj
+}
+
+func TestRuntime_state(t *testing.T) {
+	for _, engine := range engines {
+		r := New(engine)
+		mustEval(t, r, `let add = fn(a, b) { a + b };`)
+		if got := mustEval(t, r, `let base = 10;`); got != interp.NullObject {
+			t.Errorf("%s: wrong result of a let. want=null got=%s", engine, got.Inspect())
+		}
+		if got := mustEval(t, r, `add(base, 5)`); got.Inspect() != "15" {
+			t.Errorf("%s: wrong result. want=15 got=%s", engine, got.Inspect())
+		}
+		mustEval(t, r, `let twice = macro(x) { quote(unquote(x) + unquote(x)) };`)
+		if got := mustEval(t, r, `twice(base)`); got.Inspect() != "20" {
+			t.Errorf("%s: wrong macro result. want=20 got=%s", engine, got.Inspect())
+		}
+	}
+}
+
+func TestRuntime_call(t *testing.T) {
+	for _, engine := range engines {
+		r := New(engine)
+		mustEval(t, r, `let base = 10; let add = fn(a, b) { let f = fn(x) { x + base }; f(a) + b };`)
+		got, err := r.Call("add", intObj(1), intObj(2))
+		if err != nil {
+			t.Fatalf("%s: call error: %s", engine, err)
+		}
+		if got.Inspect() != "13" {
+			t.Errorf("%s: wrong result. want=13 got=%s", engine, got.Inspect())
+		}
+		if got, err := r.Call("len", &interp.String{Primitive: interp.Primitive[string]{Value: "abc"}}); err != nil || got.Inspect() != "3" {
+			t.Errorf("%s: wrong builtin result. got=%v (%v)", engine, got, err)
+		}
+		if _, err := r.Call("add", intObj(1)); KindOf(err) != interp.KindArity {
+			t.Errorf("%s: wrong arity error. got=%v", engine, err)
+		}
+		if _, err := r.Call("missing"); err == nil {
+			t.Errorf("%s: calling an undefined function succeeded", engine)
+		}
+		if _, err := r.Call("base"); KindOf(err) != interp.KindTypeMismatch {
+			t.Errorf("%s: wrong error calling an integer. got=%v", engine, err)
+		}
+	}
+}
+
+func TestRuntime_globals(t *testing.T) {
+	for _, engine := range engines {
+		r := New(engine)
+		if err := r.SetGlobal("config", map[string]any{"limit": 3, "names": []string{"a", "b"}}); err != nil {
+			t.Fatal(err)
+		}
+		if got := mustEval(t, r, `config["limit"] + len(config["names"])`); got.Inspect() != "5" {
+			t.Errorf("%s: wrong result. want=5 got=%s", engine, got.Inspect())
+		}
+		mustEval(t, r, `let total = config["limit"] * 2;`)
+		total, ok := r.GetGlobal("total")
+		if !ok {
+			t.Fatalf("%s: total is not defined", engine)
+		}
+		var n int
+		if err := interp.ToGo(total, &n); err != nil || n != 6 {
+			t.Errorf("%s: wrong total. want=6 got=%d (%v)", engine, n, err)
+		}
+		if err := r.SetGlobal("config", 1); err != nil {
+			t.Fatal(err)
+		}
+		if got := mustEval(t, r, `config`); got.Inspect() != "1" {
+			t.Errorf("%s: global is not replaced. got=%s", engine, got.Inspect())
+		}
+		if _, ok := r.GetGlobal("missing"); ok {
+			t.Errorf("%s: missing global is found", engine)
+		}
+		if err := r.SetGlobal("big", uint64(1<<63)); err == nil {
+			t.Errorf("%s: expected an error for an unsigned integer overflowing an int", engine)
+		}
+		r.SetBigInt(true)
+		if err := r.SetGlobal("big", uint64(1<<63)); err != nil {
+			t.Fatal(err)
+		}
+		if got := mustEval(t, r, `big + 1`); got.Inspect() != "9223372036854775809" {
+			t.Errorf("%s: wrong big integer. got=%s", engine, got.Inspect())
+		}
+	}
+}
+
+func TestRuntime_registerBuiltin(t *testing.T) {
+	for _, engine := range engines {
+		r := New(engine)
+		err := r.RegisterBuiltin("greet", func(args ...interp.Object) interp.Object {
+			var name string
+			if err := interp.ToGo(args[0], &name); err != nil {
+				return &interp.Error{Msg: err.Error()}
+			}
+			obj, _ := interp.FromGo("hello " + name)
+			return obj
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := mustEval(t, r, `greet("world")`); got.Inspect() != `"hello world"` {
+			t.Errorf("%s: wrong result. got=%s", engine, got.Inspect())
+		}
+	}
+}
+
+func TestRuntime_bigInt(t *testing.T) {
+	fib := `let fib = fn(n) {
+		let iter = fn(a, b, n) { if (n == 0) { a } else { iter(b, a + b, n - 1) } };
+		iter(0, 1, n)
+	};`
+	for _, engine := range engines {
+		r := New(engine)
+		mustEval(t, r, fib)
+		if got := mustEval(t, r, `fib(100)`).Inspect(); got != "3736710778780434371" {
+			t.Errorf("%s: fib(100) = %s, want the wrapped around value", engine, got)
+		}
+		r.SetBigInt(true)
+		if got := mustEval(t, r, `fib(100)`).Inspect(); got != "354224848179261915075" {
+			t.Errorf("%s: promoted fib(100) = %s", engine, got)
+		}
+		got, err := r.Call("fib", &interp.Integer{Primitive: interp.Primitive[int]{Value: 93}})
+		if err != nil || got.Inspect() != "12200160415121876738" {
+			t.Errorf("%s: Call fib(93) = %v, %v", engine, got, err)
+		}
+	}
+}
+
+func TestRuntime_collate(t *testing.T) {
+	tests := []struct {
+		input    string
+		plain    string
+		collated string
+	}{
+		{`"Z" < "a"`, "true", "false"},
+		{`"é" < "f"`, "false", "true"},
+		{`"b" > "B"`, "true", "false"},
+		{`compare("Éa", "eb")`, "1", "-1"},
+		{`compare("résumé", "resume")`, "1", "1"},
+		{`compare("Apple", "banana")`, "-1", "-1"},
+		{`compare("apple", "Banana")`, "1", "-1"},
+		{`let lt = fn(a, b) { a < b }; lt("b", "C")`, "false", "true"},
+	}
+	for _, engine := range engines {
+		r := New(engine)
+		for _, tt := range tests {
+			if got := mustEval(t, r, tt.input).Inspect(); got != tt.plain {
+				t.Errorf("%s: %s = %s, want %s", engine, tt.input, got, tt.plain)
+			}
+		}
+		r.SetCollate(true)
+		for _, tt := range tests {
+			if got := mustEval(t, r, tt.input).Inspect(); got != tt.collated {
+				t.Errorf("%s: collated %s = %s, want %s", engine, tt.input, got, tt.collated)
+			}
+		}
+		mustEval(t, r, `let lt = fn(a, b) { a < b };`)
+		got, err := r.Call("lt", &interp.String{Primitive: interp.Primitive[string]{Value: "b"}},
+			&interp.String{Primitive: interp.Primitive[string]{Value: "C"}})
+		if err != nil || got != interp.TrueObject {
+			t.Errorf("%s: collated call = %v (%v), want true", engine, got, err)
+		}
+	}
+}
+
+func TestRuntime_errors(t *testing.T) {
+	for _, engine := range engines {
+		r := New(engine)
+		var perr *ParseError
+		if _, err := r.Eval(`let = ;`); !errors.As(err, &perr) {
+			t.Errorf("%s: wrong parse error. got=%T (%v)", engine, err, err)
+		}
+		if _, err := r.Eval(`1 + true`); KindOf(err) != interp.KindTypeMismatch {
+			t.Errorf("%s: wrong runtime error. got=%T (%v)", engine, err, err)
+		}
+		if _, err := r.Eval(`1 / 0`); KindOf(err) != interp.KindDivisionByZero {
+			t.Errorf("%s: wrong runtime error. got=%T (%v)", engine, err, err)
+		}
+		// a failed eval keeps the earlier state
+		mustEval(t, r, `let ok = 1;`)
+		r.Eval(`throw("boom")`)
+		if got := mustEval(t, r, `ok`); got.Inspect() != "1" {
+			t.Errorf("%s: state lost after an error. got=%s", engine, got.Inspect())
+		}
+		// the VM drops the symbols of a failed eval, the interpreter keeps
+		// the bindings made before the error
+		r.Eval(`let a = 1; zz`)
+		got, err := r.Eval(`a + 1`)
+		switch {
+		case engine == Interpreter && (err != nil || got.Inspect() != "2"):
+			t.Errorf("%s: wrong result after a failed let. got=%v (%v)", engine, got, err)
+		case engine == VM && (err == nil || KindOf(err) == interp.KindInternal):
+			t.Errorf("%s: wrong error after a failed let. got=%v (%v)", engine, got, err)
+		}
+		if got := mustEval(t, r, `let a = 2; a + ok`); got.Inspect() != "3" {
+			t.Errorf("%s: wrong result after redefining. got=%s", engine, got.Inspect())
+		}
+		// an error within a function doesn't leave later lines in its scope
+		r.Eval(`let f = fn(a) { while (a) { undefined } };`)
+		mustEval(t, r, `let g = fn(a) { if (a) { ok } else { 0 } };`)
+		if got := mustEval(t, r, `g(true)`); got.Inspect() != "1" {
+			t.Errorf("%s: wrong result after a failed function. got=%s", engine, got.Inspect())
+		}
+	}
+}
+
+func intObj(i int) interp.Object {
+	return &interp.Integer{Primitive: interp.Primitive[int]{Value: i}}
+}